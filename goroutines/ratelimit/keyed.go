@@ -0,0 +1,156 @@
+//go:build !solution
+
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// KeyedLimiter limits events of every key, e.g. an API key or a client IP, separately.
+//
+// Limiters of keys are created on the first use. A limiter whose events all expired is idle:
+// it is equal to a new one and is evicted. To bound the memory, at most maxKeys limiters
+// are kept; when there are more, the least recently used ones are evicted even if they
+// are not idle, and their keys get the whole limit again.
+type KeyedLimiter struct {
+	mu       sync.Mutex
+	maxCount int
+	interval time.Duration
+	maxKeys  int
+
+	keys map[string]*list.Element
+	// lru holds *keyedEntry, the most recently used first.
+	lru list.List
+
+	now func() time.Time
+}
+
+type keyedEntry struct {
+	key     string
+	limiter *Limiter
+}
+
+// NewKeyedLimiter returns a limiter allowing maxCount events at any interval for every key
+// and keeping at most maxKeys keys. maxKeys <= 0 means no bound.
+func NewKeyedLimiter(maxCount int, interval time.Duration, maxKeys int) *KeyedLimiter {
+	return &KeyedLimiter{
+		maxCount: maxCount,
+		interval: interval,
+		maxKeys:  maxKeys,
+		keys:     make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// limiter returns the limiter of key, creating it if needed, and evicts other limiters. k.mu must be held.
+//
+// The event must be counted before k.mu is released: an idle limiter may be evicted
+// once it is, and the next event of key would get a new limiter with the whole limit.
+func (k *KeyedLimiter) limiter(key string) *Limiter {
+	now := k.now()
+	k.evict(now)
+
+	if e, ok := k.keys[key]; ok {
+		k.lru.MoveToFront(e)
+		return e.Value.(*keyedEntry).limiter
+	}
+
+	l := NewLimiter(k.maxCount, k.interval)
+	l.now = k.now
+	k.keys[key] = k.lru.PushFront(&keyedEntry{key: key, limiter: l})
+
+	if k.maxKeys > 0 && k.lru.Len() > k.maxKeys {
+		k.remove(k.lru.Back())
+	}
+	return l
+}
+
+// evict removes the idle limiters from the end of the LRU list. k.mu must be held.
+//
+// A limiter used later than a busy one is not checked, so idle limiters may stay
+// until the ones before them become idle. This keeps every call O(1) amortized.
+func (k *KeyedLimiter) evict(now time.Time) {
+	for e := k.lru.Back(); e != nil; e = k.lru.Back() {
+		l := e.Value.(*keyedEntry).limiter
+
+		l.mu.Lock()
+		idle := l.idle(now)
+		l.mu.Unlock()
+
+		if !idle {
+			return
+		}
+		k.remove(e)
+	}
+}
+
+func (k *KeyedLimiter) remove(e *list.Element) {
+	delete(k.keys, e.Value.(*keyedEntry).key)
+	k.lru.Remove(e)
+}
+
+// Allow reports whether an event of key may happen now, and if so, counts it.
+func (k *KeyedLimiter) Allow(key string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.limiter(key).Allow()
+}
+
+// Wait blocks until an event of key may happen and counts it, see Limiter.Wait.
+func (k *KeyedLimiter) Wait(ctx context.Context, key string) error {
+	k.mu.Lock()
+	l := k.limiter(key)
+	l.mu.Lock()
+	r, now, err := l.reserveWait(ctx)
+	l.mu.Unlock()
+	k.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	return l.wait(ctx, r, now)
+}
+
+// Status returns the state of the limit of key.
+func (k *KeyedLimiter) Status(key string) Status {
+	k.mu.Lock()
+	e, ok := k.keys[key]
+	k.mu.Unlock()
+
+	if !ok {
+		now := k.now()
+		return Status{Limit: k.maxCount, Remaining: max(k.maxCount, 0), Reset: now}
+	}
+	return e.Value.(*keyedEntry).limiter.Status()
+}
+
+// Len returns the number of the keys kept by the limiter.
+func (k *KeyedLimiter) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.lru.Len()
+}
+
+// WriteHeaders sets the X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset
+// headers, the latter in Unix seconds, and Retry-After if no events remain.
+func (s Status) WriteHeaders(h http.Header) {
+	h.Set("X-RateLimit-Limit", strconv.Itoa(s.Limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(s.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(roundUp(s.Reset), 10))
+	if s.Remaining == 0 {
+		h.Set("Retry-After", strconv.FormatInt(int64((s.RetryAfter+time.Second-1)/time.Second), 10))
+	}
+}
+
+// roundUp returns the Unix time of t rounded up to seconds.
+func roundUp(t time.Time) int64 {
+	if t.Truncate(time.Second).Equal(t) {
+		return t.Unix()
+	}
+	return t.Unix() + 1
+}
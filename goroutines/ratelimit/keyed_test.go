@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func newFakeKeyedLimiter(maxCount int, interval time.Duration, maxKeys int) (*KeyedLimiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)}
+	k := NewKeyedLimiter(maxCount, interval, maxKeys)
+	k.now = clock.Now
+	return k, clock
+}
+
+func TestKeyedLimiter(t *testing.T) {
+	k, clock := newFakeKeyedLimiter(2, time.Second, 0)
+
+	require.True(t, k.Allow("a"))
+	require.True(t, k.Allow("a"))
+	require.False(t, k.Allow("a"))
+
+	require.True(t, k.Allow("b"))
+	require.Equal(t, 2, k.Len())
+
+	clock.Advance(time.Second)
+	require.True(t, k.Allow("a"))
+}
+
+func TestKeyedLimiter_status(t *testing.T) {
+	k, clock := newFakeKeyedLimiter(3, time.Minute, 0)
+	start := clock.Now()
+
+	require.Equal(t, Status{Limit: 3, Remaining: 3, Reset: start}, k.Status("a"))
+	require.Equal(t, 0, k.Len(), "Status must not create limiters")
+
+	require.True(t, k.Allow("a"))
+	clock.Advance(10 * time.Second)
+	require.True(t, k.Allow("a"))
+	require.Equal(t, Status{Limit: 3, Remaining: 1, Reset: start.Add(70 * time.Second)}, k.Status("a"))
+
+	require.True(t, k.Allow("a"))
+	require.Equal(t, Status{
+		Limit:      3,
+		Remaining:  0,
+		Reset:      start.Add(70 * time.Second),
+		RetryAfter: 50 * time.Second,
+	}, k.Status("a"))
+
+	clock.Advance(50 * time.Second)
+	require.Equal(t, Status{Limit: 3, Remaining: 1, Reset: start.Add(70 * time.Second)}, k.Status("a"))
+}
+
+func TestKeyedLimiter_evictIdle(t *testing.T) {
+	k, clock := newFakeKeyedLimiter(1, time.Second, 0)
+
+	for i := 0; i < 100; i++ {
+		require.True(t, k.Allow(fmt.Sprint(i)))
+	}
+	require.Equal(t, 100, k.Len())
+
+	clock.Advance(500 * time.Millisecond)
+	require.True(t, k.Allow("busy"))
+	require.Equal(t, 101, k.Len())
+
+	clock.Advance(500 * time.Millisecond)
+	require.False(t, k.Allow("busy"))
+	require.Equal(t, 1, k.Len())
+
+	clock.Advance(time.Second)
+	require.True(t, k.Allow("other"))
+	require.Equal(t, 1, k.Len())
+}
+
+func TestKeyedLimiter_maxKeys(t *testing.T) {
+	k, _ := newFakeKeyedLimiter(1, time.Hour, 2)
+
+	require.True(t, k.Allow("a"))
+	require.True(t, k.Allow("b"))
+	require.False(t, k.Allow("a"))
+
+	// b is the least recently used.
+	require.True(t, k.Allow("c"))
+	require.Equal(t, 2, k.Len())
+
+	require.False(t, k.Allow("a"))
+	require.True(t, k.Allow("b"), "the evicted key gets the whole limit")
+}
+
+func TestKeyedLimiter_wait(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	k := NewKeyedLimiter(1, time.Hour, 0)
+
+	require.NoError(t, k.Wait(context.Background(), "a"))
+	require.NoError(t, k.Wait(context.Background(), "b"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, k.Wait(ctx, "a"))
+}
+
+func TestStatus_writeHeaders(t *testing.T) {
+	reset := time.Date(2021, 3, 1, 12, 0, 0, 500, time.UTC)
+
+	h := make(http.Header)
+	Status{Limit: 10, Remaining: 3, Reset: reset}.WriteHeaders(h)
+	require.Equal(t, http.Header{
+		"X-Ratelimit-Limit":     {"10"},
+		"X-Ratelimit-Remaining": {"3"},
+		"X-Ratelimit-Reset":     {fmt.Sprint(reset.Unix() + 1)},
+	}, h)
+
+	h = make(http.Header)
+	Status{Limit: 10, Remaining: 0, Reset: reset, RetryAfter: 1500 * time.Millisecond}.WriteHeaders(h)
+	require.Equal(t, "0", h.Get("X-RateLimit-Remaining"))
+	require.Equal(t, "2", h.Get("Retry-After"))
+}
+
+func BenchmarkKeyedLimiter(b *testing.B) {
+	b.ReportAllocs()
+
+	k := NewKeyedLimiter(100, time.Second, 10000)
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprint("client-", i)
+	}
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			k.Allow(keys[i%len(keys)])
+			i++
+		}
+	})
+}
@@ -0,0 +1,264 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newFakeLimiter(maxCount int, interval time.Duration) (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewLimiter(maxCount, interval)
+	l.now = clock.Now
+	return l, clock
+}
+
+func TestAllow(t *testing.T) {
+	l, clock := newFakeLimiter(3, time.Second)
+
+	require.True(t, l.Allow())
+	clock.Advance(100 * time.Millisecond)
+	require.True(t, l.Allow())
+	require.True(t, l.Allow())
+	require.False(t, l.Allow())
+
+	clock.Advance(899 * time.Millisecond)
+	require.False(t, l.Allow())
+
+	clock.Advance(time.Millisecond)
+	require.True(t, l.Allow())
+	require.False(t, l.Allow())
+
+	clock.Advance(100 * time.Millisecond)
+	require.True(t, l.Allow())
+	require.True(t, l.Allow())
+	require.False(t, l.Allow())
+
+	l.Stop()
+	clock.Advance(time.Hour)
+	require.False(t, l.Allow())
+}
+
+func TestReserve(t *testing.T) {
+	l, clock := newFakeLimiter(2, time.Second)
+
+	var delays []time.Duration
+	for i := 0; i < 5; i++ {
+		r := l.Reserve()
+		require.True(t, r.OK())
+		delays = append(delays, r.Delay())
+	}
+	require.Equal(t, []time.Duration{0, 0, time.Second, time.Second, 2 * time.Second}, delays)
+
+	clock.Advance(1500 * time.Millisecond)
+	require.False(t, l.Allow())
+
+	l.Stop()
+	require.False(t, l.Reserve().OK())
+}
+
+func TestReserve_cancel(t *testing.T) {
+	l, clock := newFakeLimiter(1, time.Second)
+
+	require.True(t, l.Allow())
+
+	r1 := l.Reserve()
+	r2 := l.Reserve()
+	require.Equal(t, 2*time.Second, r2.Delay())
+
+	// Only the latest reservation returns its slot.
+	r1.Cancel()
+	require.Equal(t, 3*time.Second, l.Reserve().Delay())
+
+	l, clock = newFakeLimiter(1, time.Second)
+	require.True(t, l.Allow())
+
+	r := l.Reserve()
+	require.Equal(t, time.Second, r.Delay())
+	r.Cancel()
+	r.Cancel()
+	require.Equal(t, time.Second, l.Reserve().Delay())
+
+	// A reservation whose time has come is used.
+	clock.Advance(time.Second)
+	r = l.Reserve()
+	clock.Advance(time.Second)
+	r.Cancel()
+	require.False(t, l.Allow())
+}
+
+func TestZeroMaxCount(t *testing.T) {
+	l, _ := newFakeLimiter(0, time.Second)
+
+	require.False(t, l.Allow())
+	require.False(t, l.Reserve().OK())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, l.Wait(ctx))
+}
+
+func TestSetLimit(t *testing.T) {
+	l, clock := newFakeLimiter(2, time.Second)
+
+	require.True(t, l.Allow())
+	clock.Advance(100 * time.Millisecond)
+	require.True(t, l.Allow())
+	require.False(t, l.Allow())
+
+	l.SetLimit(4, time.Second)
+	maxCount, interval := l.Limit()
+	require.Equal(t, 4, maxCount)
+	require.Equal(t, time.Second, interval)
+
+	require.True(t, l.Allow())
+	require.True(t, l.Allow())
+	require.False(t, l.Allow())
+
+	// The oldest events are forgotten.
+	l.SetLimit(1, 2*time.Second)
+	require.False(t, l.Allow())
+	clock.Advance(2 * time.Second)
+	require.True(t, l.Allow())
+
+	l.SetLimit(0, time.Second)
+	require.False(t, l.Allow())
+	l.SetLimit(1, time.Second)
+	require.True(t, l.Allow())
+}
+
+func TestWait_stop(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	l := NewLimiter(1, time.Hour)
+	require.NoError(t, l.Wait(context.Background()))
+
+	errs := make(chan error)
+	go func() {
+		errs <- l.Wait(context.Background())
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	l.Stop()
+	l.Stop()
+	require.Equal(t, ErrStopped, <-errs)
+}
+
+func TestWait_deadlineSkipsReservation(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	l := NewLimiter(1, 50*time.Millisecond)
+	defer l.Stop()
+
+	require.NoError(t, l.Wait(context.Background()))
+
+	// The slot after 50ms is beyond the deadline and stays free.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, l.Wait(ctx))
+
+	r := l.Reserve()
+	require.True(t, r.OK())
+	require.Less(t, r.Delay(), 50*time.Millisecond)
+	r.Cancel()
+}
+
+func TestWait_precise(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const (
+		maxCount = 10
+		interval = 50 * time.Millisecond
+	)
+
+	l := NewLimiter(maxCount, interval)
+	defer l.Stop()
+
+	var mu sync.Mutex
+	var times []time.Time
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if err := l.Wait(context.Background()); err != nil {
+					t.Errorf("wait failed: %v", err)
+					return
+				}
+
+				mu.Lock()
+				times = append(times, time.Now())
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, times, 40)
+	// 40 events at 10 per 50ms take at least 150ms.
+	first, last := times[0], times[0]
+	for _, at := range times {
+		if at.Before(first) {
+			first = at
+		}
+		if at.After(last) {
+			last = at
+		}
+	}
+	require.GreaterOrEqual(t, last.Sub(first), 3*interval-5*time.Millisecond)
+}
+
+func BenchmarkAllow(b *testing.B) {
+	b.ReportAllocs()
+
+	l := NewLimiter(1024, time.Nanosecond)
+	defer l.Stop()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			l.Allow()
+		}
+	})
+}
+
+// BenchmarkWait1M measures Wait of a limiter allowing 1M events per second.
+func BenchmarkWait1M(b *testing.B) {
+	b.ReportAllocs()
+
+	l := NewLimiter(1000, time.Millisecond)
+	defer l.Stop()
+
+	ctx := context.Background()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := l.Wait(ctx); err != nil {
+				b.Errorf("wait failed: %v", err)
+			}
+		}
+	})
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "ops/s")
+}
@@ -5,17 +5,33 @@ package ratelimit
 import (
 	"context"
 	"errors"
+	"sort"
 	"sync"
 	"time"
 )
 
 // Limiter is precise rate limiter with context support.
+//
+// Limiter is a sliding window: it remembers the times of the last maxCount events
+// and allows the next event interval after the oldest of them. Availability is computed
+// from these times, so Limiter needs no goroutines or timers except for blocked calls.
 type Limiter struct {
-	interval    time.Duration
-	sema        chan struct{}
+	mu       sync.Mutex
+	maxCount int
+	interval time.Duration
+
+	// window is a ring of the times of the last maxCount events, including reserved ones.
+	// window[next%maxCount] is the oldest event.
+	window []time.Time
+	// next is the sequence number of the next event.
+	next uint64
+	// generation is incremented by SetLimit, invalidating cancellation of older reservations.
+	generation uint64
+
 	stopped     chan struct{}
 	flagStopped bool
-	mu          sync.Mutex
+
+	now func() time.Time
 }
 
 var ErrStopped = errors.New("limiter stopped")
@@ -23,69 +39,269 @@ var ErrStopped = errors.New("limiter stopped")
 // NewLimiter returns limiter that throttles rate of successful Acquire() calls
 // to maxSize events at any given interval.
 func NewLimiter(maxCount int, interval time.Duration) *Limiter {
-	limiter := Limiter{
+	return &Limiter{
+		maxCount: maxCount,
 		interval: interval,
-		sema:     make(chan struct{}, maxCount),
+		window:   make([]time.Time, max(maxCount, 0)),
 		stopped:  make(chan struct{}),
+		now:      time.Now,
+	}
+}
+
+// Reservation is a permission to perform an event at some time, returned by Reserve.
+type Reservation struct {
+	l  *Limiter
+	ok bool
+	at time.Time
+
+	seq, generation uint64
+	// prev is the event time replaced in the window by the reservation.
+	prev time.Time
+}
+
+// OK reports whether the event was reserved. The event can never happen
+// if maxCount is zero, and it can't be reserved after Stop.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Time returns the time the event may happen at.
+func (r *Reservation) Time() time.Time {
+	return r.at
+}
+
+// Delay returns the time left until the event may happen, 0 if it may happen now.
+func (r *Reservation) Delay() time.Duration {
+	if !r.ok {
+		return 0
+	}
+	return max(0, r.at.Sub(r.l.now()))
+}
+
+// Cancel gives the reservation up if its time has not come yet.
+//
+// Only the latest reservation returns its slot to the limiter: later reservations
+// were scheduled after this one, and moving them is not possible. Other canceled
+// reservations keep their slots, so the limit still holds, but the throughput drops.
+func (r *Reservation) Cancel() {
+	if !r.ok {
+		return
 	}
-	for _ = range maxCount {
-		limiter.sema <- struct{}{}
+
+	l := r.l
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if r.generation != l.generation || r.seq+1 != l.next || !r.at.After(l.now()) {
+		return
 	}
-	return &limiter
+	l.next--
+	l.window[l.next%uint64(l.maxCount)] = r.prev
 }
 
-func (l *Limiter) Acquire(ctx context.Context) error {
+// reserve reserves the next event if it may happen not later than deadline. l.mu must be held.
+func (l *Limiter) reserve(now, deadline time.Time) (Reservation, bool) {
+	if l.maxCount <= 0 {
+		return Reservation{}, false
+	}
+
+	i := l.next % uint64(l.maxCount)
+	at := now
+	if oldest := l.window[i].Add(l.interval); oldest.After(now) {
+		at = oldest
+	}
+	if at.After(deadline) {
+		return Reservation{}, false
+	}
+
+	r := Reservation{l: l, ok: true, at: at, seq: l.next, generation: l.generation, prev: l.window[i]}
+	l.window[i] = at
+	l.next++
+	return r, true
+}
+
+// Allow reports whether an event may happen now, and if so, counts it.
+func (l *Limiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.flagStopped {
+		return false
+	}
+	now := l.now()
+	_, ok := l.reserve(now, now)
+	return ok
+}
+
+// Reserve reserves the next event. The caller must wait for Delay before performing it,
+// or Cancel the reservation.
+func (l *Limiter) Reserve() *Reservation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.flagStopped {
+		return &Reservation{l: l}
+	}
+
+	r, _ := l.reserve(l.now(), farFuture)
+	return &r
+}
+
+var farFuture = time.Unix(1<<62, 0)
+
+// Wait blocks until an event may happen and counts it.
+//
+// An event that can't happen before the deadline of ctx is not reserved,
+// so that other calls may use its slot. In this case, and if ctx is canceled,
+// Wait returns ctx.Err() once ctx is done. After Stop, Wait returns ErrStopped.
+func (l *Limiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	r, now, err := l.reserveWait(ctx)
+	l.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	return l.wait(ctx, r, now)
+}
+
+// reserveWait reserves the event of Wait if it may happen before the deadline of ctx. l.mu must be held.
+func (l *Limiter) reserveWait(ctx context.Context) (Reservation, time.Time, error) {
+	if l.flagStopped {
+		return Reservation{}, time.Time{}, ErrStopped
+	}
+	if err := ctx.Err(); err != nil {
+		return Reservation{}, time.Time{}, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = farFuture
+	}
+
+	now := l.now()
+	r, _ := l.reserve(now, deadline)
+	return r, now, nil
+}
+
+// wait waits for the reservation r made at now, or for ctx if the event was not reserved.
+func (l *Limiter) wait(ctx context.Context, r Reservation, now time.Time) error {
+	if r.ok && !r.at.After(now) {
+		return nil
+	}
+
+	var timer <-chan time.Time
+	if r.ok {
+		t := time.NewTimer(r.at.Sub(now))
+		defer t.Stop()
+		timer = t.C
+	}
+
 	select {
+	case <-timer:
+		return nil
+	case <-ctx.Done():
+		if r.ok {
+			r.Cancel()
+		}
+		return ctx.Err()
 	case <-l.stopped:
 		return ErrStopped
-	default:
 	}
+}
 
-	select {
-	case _, ok := <-l.sema:
-		if !ok {
-			return ErrStopped
+// Acquire is Wait.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	return l.Wait(ctx)
+}
+
+// SetLimit changes the limit to maxCount events at any interval.
+//
+// Events that already happened or were reserved count against the new limit,
+// the earlier ones are forgotten if maxCount decreases.
+func (l *Limiter) SetLimit(maxCount int, interval time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	window := make([]time.Time, max(maxCount, 0))
+	// Copy the latest events, the newest one goes last.
+	if n := uint64(len(l.window)); n != 0 {
+		for i := 1; i <= min(len(window), len(l.window)); i++ {
+			window[len(window)-i] = l.window[(l.next+n-uint64(i))%n]
 		}
+	}
 
-		go func() {
-			writeBack := func() {
-				l.mu.Lock()
-				defer l.mu.Unlock()
-				if l.flagStopped {
-					return
-				}
-				l.sema <- struct{}{}
-			}
-
-			if l.interval == 0 {
-				select {
-				case <-l.stopped:
-				default:
-					writeBack()
-				}
-				return
-			}
-
-			ticker := time.NewTicker(l.interval)
-			defer ticker.Stop()
-
-			select {
-			case <-l.stopped:
-			case <-ticker.C:
-				writeBack()
-			}
-		}()
+	l.maxCount = maxCount
+	l.interval = interval
+	l.window = window
+	l.next = 0
+	l.generation++
+}
 
-		return nil
-	case <-ctx.Done():
-		return ctx.Err()
+// Status is the state of a limiter at some moment.
+type Status struct {
+	Limit int
+	// Remaining is the number of events that may happen now.
+	Remaining int
+	// Reset is the time the whole limit is available again.
+	Reset time.Time
+	// RetryAfter is the time left until the next event may happen, 0 if Remaining is positive.
+	RetryAfter time.Duration
+}
+
+// Status returns the current state of the limiter.
+func (l *Limiter) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.status(l.now())
+}
+
+// status counts the events of the window not older than interval. l.mu must be held.
+func (l *Limiter) status(now time.Time) Status {
+	s := Status{Limit: l.maxCount, Reset: now}
+
+	n := uint64(len(l.window))
+	if n == 0 {
+		return s
+	}
+	event := func(i int) time.Time {
+		return l.window[(l.next+uint64(i))%n]
 	}
+
+	// The window is sorted from the oldest event to the newest one.
+	expired := sort.Search(int(n), func(i int) bool {
+		return event(i).Add(l.interval).After(now)
+	})
+	s.Remaining = expired
+	if expired == 0 {
+		s.RetryAfter = event(0).Add(l.interval).Sub(now)
+	}
+	if newest := event(int(n) - 1).Add(l.interval); newest.After(now) {
+		s.Reset = newest
+	}
+	return s
+}
+
+// idle reports whether the limiter is in the initial state: all its events expired. l.mu must be held.
+func (l *Limiter) idle(now time.Time) bool {
+	n := uint64(len(l.window))
+	return n == 0 || !l.window[(l.next+n-1)%n].Add(l.interval).After(now)
+}
+
+// Limit returns the current limit.
+func (l *Limiter) Limit() (maxCount int, interval time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.maxCount, l.interval
 }
 
 func (l *Limiter) Stop() {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+
+	if l.flagStopped {
+		return
+	}
 	l.flagStopped = true
 	close(l.stopped)
-	close(l.sema)
 }
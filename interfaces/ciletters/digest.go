@@ -0,0 +1,156 @@
+//go:build !solution
+
+package ciletters
+
+import (
+	"cmp"
+	"embed"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Digest summarizes many pipelines, grouped by project and branch.
+type Digest struct {
+	Pipelines int
+	Groups    []DigestGroup
+}
+
+// DigestGroup summarizes the pipelines of a branch.
+type DigestGroup struct {
+	Project GitlabProject
+	Branch  string
+
+	Passed, Failed int
+
+	// LastFailure is the failed pipeline with the largest ID, nil if none failed.
+	LastFailure *Notification
+
+	// FlakyJobs are the jobs that both failed and passed on the same commit.
+	FlakyJobs []FlakyJob
+}
+
+// FlakyJob is a job that both failed and passed on a commit.
+type FlakyJob struct {
+	Commit      Commit
+	Stage, Name string
+	// Failures and Passes count the pipelines of the commit in which the job failed and passed.
+	Failures, Passes int
+}
+
+type digestKey struct {
+	project GitlabProject
+	branch  string
+}
+
+type jobKey struct {
+	commit, stage, name string
+}
+
+// MakeDigest groups the notifications by project and branch.
+//
+// Pipeline IDs order the pipelines. A job counts as passed in every pipeline of the same commit
+// that does not list it in FailedJobs, as all pipelines of a commit run the same jobs.
+func MakeDigest(ns []Notification) *Digest {
+	byBranch := make(map[digestKey][]*Notification)
+	for i := range ns {
+		n := &ns[i]
+		key := digestKey{project: n.Project, branch: n.Branch}
+		byBranch[key] = append(byBranch[key], n)
+	}
+
+	d := &Digest{Pipelines: len(ns)}
+	for key, pipelines := range byBranch {
+		d.Groups = append(d.Groups, makeDigestGroup(key, pipelines))
+	}
+	slices.SortFunc(d.Groups, func(a, b DigestGroup) int {
+		return cmp.Or(
+			cmp.Compare(a.Project.GroupID, b.Project.GroupID),
+			cmp.Compare(a.Project.ID, b.Project.ID),
+			cmp.Compare(a.Branch, b.Branch),
+		)
+	})
+	return d
+}
+
+func makeDigestGroup(key digestKey, pipelines []*Notification) DigestGroup {
+	slices.SortStableFunc(pipelines, func(a, b *Notification) int {
+		return cmp.Compare(a.Pipeline.ID, b.Pipeline.ID)
+	})
+
+	g := DigestGroup{Project: key.project, Branch: key.branch}
+
+	byCommit := make(map[string][]*Notification)
+	var commits []string
+	for _, n := range pipelines {
+		if n.Pipeline.Status == PipelineStatusOK {
+			g.Passed++
+		} else {
+			g.Failed++
+			g.LastFailure = n
+		}
+
+		if _, ok := byCommit[n.Commit.Hash]; !ok {
+			commits = append(commits, n.Commit.Hash)
+		}
+		byCommit[n.Commit.Hash] = append(byCommit[n.Commit.Hash], n)
+	}
+
+	for _, hash := range commits {
+		g.FlakyJobs = append(g.FlakyJobs, flakyJobs(byCommit[hash])...)
+	}
+	return g
+}
+
+// flakyJobs finds the flaky jobs among the pipelines of a commit.
+func flakyJobs(pipelines []*Notification) []FlakyJob {
+	var jobs []FlakyJob
+	index := make(map[jobKey]int)
+
+	for _, n := range pipelines {
+		for _, job := range n.Pipeline.FailedJobs {
+			key := jobKey{commit: n.Commit.Hash, stage: job.Stage, name: job.Name}
+			i, ok := index[key]
+			if !ok {
+				i = len(jobs)
+				index[key] = i
+				jobs = append(jobs, FlakyJob{Commit: n.Commit, Stage: job.Stage, Name: job.Name})
+			}
+			jobs[i].Failures++
+		}
+	}
+
+	var flaky []FlakyJob
+	for _, job := range jobs {
+		job.Passes = len(pipelines) - job.Failures
+		if job.Passes > 0 {
+			flaky = append(flaky, job)
+		}
+	}
+	return flaky
+}
+
+//go:embed digest.txt
+var digestPattern embed.FS
+
+var digestTemplate = sync.OnceValues(func() (*TemplateRenderer, error) {
+	return loadTemplate(digestPattern, "digest.txt", templateTypes[".txt"], sampleDigests)
+})
+
+// MakeDigestLetter renders the digest of the notifications as plain text.
+func MakeDigestLetter(ns []Notification) (string, error) {
+	r, err := digestTemplate()
+	if err != nil {
+		return "", err
+	}
+
+	var ans strings.Builder
+	err = r.tmpl.Execute(&ans, MakeDigest(ns))
+	return ans.String(), err
+}
+
+// sampleDigests cover the branches of a digest template.
+var sampleDigests = []Digest{
+	*MakeDigest(nil),
+	*MakeDigest(slices.Concat(sampleNotifications, sampleNotifications[:1])),
+}
@@ -0,0 +1,91 @@
+package ciletters
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func digestNotification(project, branch, hash string, id int64, failed ...string) Notification {
+	n := Notification{
+		Project:  GitlabProject{GroupID: "go-spring-2021", ID: project},
+		Branch:   branch,
+		Commit:   Commit{Hash: hash, Message: "Commit " + hash[:4] + ".", Author: "gopher"},
+		Pipeline: Pipeline{Status: PipelineStatusOK, ID: id, TriggeredBy: "gopher"},
+	}
+	if len(failed) != 0 {
+		n.Pipeline.Status = PipelineStatusFailed
+	}
+	for i, name := range failed {
+		n.Pipeline.FailedJobs = append(n.Pipeline.FailedJobs, Job{
+			ID:        id*10 + int64(i),
+			Name:      name,
+			Stage:     "test",
+			RunnerLog: "--- FAIL: Test" + name + "\nERROR: Job failed in pipeline #" + string(rune('0'+id%10)),
+		})
+	}
+	return n
+}
+
+const (
+	hashA = "aaaaaaaa8aa7b270af6447dae594eb87bdae8791"
+	hashB = "bbbbbbbb8aa7b270af6447dae594eb87bdae8791"
+)
+
+var digestNotifications = []Notification{
+	digestNotification("gopher", "master", hashA, 3, "grade"),
+	digestNotification("gopher", "master", hashA, 1, "grade", "lint"),
+	digestNotification("gopher", "master", hashA, 2),
+	digestNotification("gopher", "master", hashB, 5, "lint"),
+	digestNotification("gopher", "master", hashB, 4, "lint"),
+	digestNotification("gopher", "feature", hashB, 6),
+	digestNotification("alice", "master", hashA, 7, "grade"),
+}
+
+func TestMakeDigest(t *testing.T) {
+	d := MakeDigest(digestNotifications)
+	require.Equal(t, 7, d.Pipelines)
+	require.Len(t, d.Groups, 3)
+
+	alice, feature, master := d.Groups[0], d.Groups[1], d.Groups[2]
+
+	require.Equal(t, "alice", alice.Project.ID)
+	require.Equal(t, 0, alice.Passed)
+	require.Equal(t, 1, alice.Failed)
+	require.Empty(t, alice.FlakyJobs)
+
+	require.Equal(t, "feature", feature.Branch)
+	require.Equal(t, 1, feature.Passed)
+	require.Nil(t, feature.LastFailure)
+
+	require.Equal(t, "master", master.Branch)
+	require.Equal(t, 1, master.Passed)
+	require.Equal(t, 4, master.Failed)
+	require.Equal(t, int64(5), master.LastFailure.Pipeline.ID)
+	require.Equal(t, []FlakyJob{
+		{Commit: digestNotifications[1].Commit, Stage: "test", Name: "grade", Failures: 2, Passes: 1},
+		{Commit: digestNotifications[1].Commit, Stage: "test", Name: "lint", Failures: 1, Passes: 2},
+	}, master.FlakyJobs)
+}
+
+func TestMakeDigestLetter(t *testing.T) {
+	letter, err := MakeDigestLetter(digestNotifications)
+	require.NoError(t, err)
+
+	golden := filepath.Join("testdata", "digest.golden")
+	if *update {
+		require.NoError(t, os.WriteFile(golden, []byte(letter), 0o644))
+	}
+
+	expected, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	require.Equal(t, string(expected), letter)
+}
+
+func TestMakeDigestLetter_empty(t *testing.T) {
+	letter, err := MakeDigestLetter(nil)
+	require.NoError(t, err)
+	require.Equal(t, "Digest of 0 pipelines", letter)
+}
@@ -0,0 +1,193 @@
+//go:build !solution
+
+package ciletters
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// excerptContext is the number of lines shown around a failure.
+	excerptContext = 3
+	// excerptTail is the number of the last lines of a log always shown, they hold the reason the job failed.
+	excerptTail = 4
+	// panicLines bounds the lines of a panic trace.
+	panicLines = 20
+
+	// MaxLogSize bounds the total size of the log excerpts of a letter.
+	MaxLogSize = 16 << 10
+)
+
+var (
+	ansiEscape   = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+	compileError = regexp.MustCompile(`^\S+\.go:\d+(:\d+)?: `)
+)
+
+// cleanLog removes terminal escape sequences and the lines overwritten with carriage returns.
+func cleanLog(log string) []string {
+	lines := strings.Split(strings.ReplaceAll(log, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		line = ansiEscape.ReplaceAllString(line, "")
+		if j := strings.LastIndexByte(line, '\r'); j != -1 {
+			line = line[j+1:]
+		}
+		lines[i] = line
+	}
+	return lines
+}
+
+// collapseRepeats replaces runs of equal lines with a single line.
+func collapseRepeats(lines []string) []string {
+	var collapsed []string
+	for i := 0; i < len(lines); {
+		j := i + 1
+		for j < len(lines) && lines[j] == lines[i] {
+			j++
+		}
+
+		if j-i > 1 && strings.TrimSpace(lines[i]) != "" {
+			collapsed = append(collapsed, fmt.Sprintf("%s (repeated %d times)", lines[i], j-i))
+		} else {
+			collapsed = append(collapsed, lines[i:j]...)
+		}
+		i = j
+	}
+	return collapsed
+}
+
+func isIndented(line string) bool {
+	return strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
+}
+
+// failureEnd returns the end of the failure block starting at lines[i], or -1 if there is none.
+func failureEnd(lines []string, i int) int {
+	line := lines[i]
+	switch {
+	case strings.HasPrefix(strings.TrimSpace(line), "--- FAIL:"):
+		j := i + 1
+		for j < len(lines) && isIndented(lines[j]) && !strings.HasPrefix(strings.TrimSpace(lines[j]), "--- ") {
+			j++
+		}
+		return j
+
+	case strings.HasPrefix(line, "panic: "), strings.HasPrefix(line, "fatal error: "):
+		j := i + 1
+		for j < len(lines) && j-i < panicLines && !strings.HasPrefix(lines[j], "FAIL") && !strings.HasPrefix(lines[j], "exit status") {
+			j++
+		}
+		return j
+
+	case strings.Contains(line, "WARNING: DATA RACE"):
+		j := i + 1
+		for j < len(lines) && !strings.HasPrefix(lines[j], "==================") {
+			j++
+		}
+		return min(j+1, len(lines))
+
+	case compileError.MatchString(line):
+		j := i + 1
+		for j < len(lines) && (compileError.MatchString(lines[j]) || isIndented(lines[j])) {
+			j++
+		}
+		return j
+	}
+	return -1
+}
+
+// excerptRanges returns the sorted disjoint ranges of lines to show.
+func excerptRanges(lines []string) [][2]int {
+	var ranges [][2]int
+	add := func(from, to int) {
+		from, to = max(0, from), min(len(lines), to)
+		if n := len(ranges); n != 0 && from <= ranges[n-1][1] {
+			ranges[n-1][1] = max(ranges[n-1][1], to)
+			return
+		}
+		ranges = append(ranges, [2]int{from, to})
+	}
+
+	for i := 0; i < len(lines); i++ {
+		end := failureEnd(lines, i)
+		if end == -1 {
+			continue
+		}
+
+		from := i
+		// The package header of compiler errors.
+		if from > 0 && compileError.MatchString(lines[i]) && strings.HasPrefix(lines[from-1], "# ") {
+			from--
+		}
+		add(from-excerptContext, end+excerptContext)
+		i = end - 1
+	}
+
+	if len(ranges) == 0 {
+		add(len(lines)-logLines, len(lines))
+	} else {
+		add(len(lines)-excerptTail, len(lines))
+	}
+	return ranges
+}
+
+// excerpt returns the interesting lines of a job log: Go test failures, panics, data races
+// and compiler errors with excerptContext lines around them and the last lines of the log,
+// or the last logLines lines if the log has no recognized failures.
+//
+// Terminal escape sequences are removed and repeated lines are collapsed.
+// Lines omitted between the shown ones are marked with "...".
+// An excerpt longer than maxBytes loses its first lines.
+func excerpt(maxBytes int, log string) string {
+	lines := collapseRepeats(cleanLog(strings.TrimSpace(log)))
+
+	var shown []string
+	end := 0
+	for _, r := range excerptRanges(lines) {
+		if end != 0 && r[0] > end {
+			shown = append(shown, "...")
+		}
+		shown = append(shown, lines[r[0]:r[1]]...)
+		end = r[1]
+	}
+
+	text := strings.TrimSpace(strings.Join(shown, "\n"))
+	if len(text) <= maxBytes {
+		return text
+	}
+	return cutStart(text, maxBytes)
+}
+
+// cutStart keeps the last complete lines of text fitting into maxBytes with a "..." line.
+func cutStart(text string, maxBytes int) string {
+	const marker = "...\n"
+	if maxBytes < len(marker) {
+		return ""
+	}
+
+	text = text[len(text)-(maxBytes-len(marker)):]
+	i := strings.IndexByte(text, '\n')
+	if i == -1 {
+		return strings.TrimSpace(marker)
+	}
+	return marker + text[i+1:]
+}
+
+// JobExcerpt is a failed job with the excerpt of its log.
+type JobExcerpt struct {
+	Job
+	Log string
+}
+
+// excerpts returns the log excerpts of jobs, sharing MaxLogSize between them.
+// A job whose log did not fit gets an empty excerpt.
+func excerpts(jobs []Job) []JobExcerpt {
+	budget := MaxLogSize
+	result := make([]JobExcerpt, len(jobs))
+	for i, job := range jobs {
+		log := excerpt(budget/(len(jobs)-i), job.RunnerLog)
+		budget -= len(log)
+		result[i] = JobExcerpt{Job: job, Log: log}
+	}
+	return result
+}
@@ -0,0 +1,167 @@
+package ciletters
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func numbered(prefix string, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("%s %d", prefix, i+1)
+	}
+	return lines
+}
+
+func joinLines(parts ...[]string) string {
+	var lines []string
+	for _, p := range parts {
+		lines = append(lines, p...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestExcerpt(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		log      string
+		expected string
+	}{
+		{
+			name:     "noFailures",
+			log:      joinLines(numbered("line", 15)),
+			expected: joinLines(numbered("line", 15)[5:]),
+		},
+		{
+			name:     "ansi",
+			log:      "\x1b[0Ksection_start:1:step\r\x1b[0K\x1b[32;1m$ go test ./...\x1b[0;m\n\x1b[31mFAIL\x1b[0m",
+			expected: "$ go test ./...\nFAIL",
+		},
+		{
+			name: "testFailures",
+			log: joinLines(
+				numbered("setup", 10),
+				[]string{"=== RUN   TestA", "--- FAIL: TestA (0.00s)", "    a_test.go:1: boom"},
+				numbered("between", 10),
+				[]string{"--- FAIL: TestB (0.00s)", "    b_test.go:2: bang"},
+				numbered("teardown", 10),
+			),
+			expected: joinLines(
+				[]string{"setup 9", "setup 10", "=== RUN   TestA", "--- FAIL: TestA (0.00s)", "    a_test.go:1: boom"},
+				numbered("between", 3),
+				[]string{"..."},
+				numbered("between", 10)[7:],
+				[]string{"--- FAIL: TestB (0.00s)", "    b_test.go:2: bang"},
+				numbered("teardown", 3),
+				[]string{"..."},
+				numbered("teardown", 10)[6:],
+			),
+		},
+		{
+			name: "panic",
+			log: joinLines(
+				numbered("setup", 10),
+				[]string{"panic: runtime error: index out of range [1] with length 1", "", "goroutine 7 [running]:", "main.f()", "\t/src/main.go:5 +0x1d"},
+				[]string{"exit status 2", "FAIL\tpkg\t0.01s"},
+				numbered("teardown", 10),
+			),
+			expected: joinLines(
+				numbered("setup", 10)[7:],
+				[]string{"panic: runtime error: index out of range [1] with length 1", "", "goroutine 7 [running]:", "main.f()", "\t/src/main.go:5 +0x1d"},
+				[]string{"exit status 2", "FAIL\tpkg\t0.01s", "teardown 1"},
+				[]string{"..."},
+				numbered("teardown", 10)[6:],
+			),
+		},
+		{
+			name: "race",
+			log: joinLines(
+				numbered("setup", 10),
+				[]string{"==================", "WARNING: DATA RACE", "Write at 0x00c000 by goroutine 8:", "  main.f()", "==================", "ok 1"},
+				numbered("teardown", 10),
+			),
+			expected: joinLines(
+				numbered("setup", 10)[8:],
+				[]string{"==================", "WARNING: DATA RACE", "Write at 0x00c000 by goroutine 8:", "  main.f()", "==================", "ok 1"},
+				numbered("teardown", 2),
+				[]string{"..."},
+				numbered("teardown", 10)[6:],
+			),
+		},
+		{
+			name: "compileErrors",
+			log: joinLines(
+				numbered("setup", 10),
+				[]string{"# gitlab.com/slon/shad-go/sum", "sum/sum.go:5:2: undefined: x", "sum/sum.go:6:9: cannot use y (variable of type string) as int value"},
+				numbered("teardown", 10),
+			),
+			expected: joinLines(
+				numbered("setup", 10)[7:],
+				[]string{"# gitlab.com/slon/shad-go/sum", "sum/sum.go:5:2: undefined: x", "sum/sum.go:6:9: cannot use y (variable of type string) as int value"},
+				numbered("teardown", 3),
+				[]string{"..."},
+				numbered("teardown", 10)[6:],
+			),
+		},
+		{
+			name:     "repeats",
+			log:      joinLines([]string{"start"}, strings.Split(strings.Repeat("retrying\n", 100), "\n"), []string{"", "", "done"}),
+			expected: "start\nretrying (repeated 100 times)\n\n\n\ndone",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, excerpt(MaxLogSize, tc.log))
+		})
+	}
+}
+
+func TestExcerpt_maxBytes(t *testing.T) {
+	log := joinLines(numbered("line", 10))
+
+	require.Equal(t, "...\nline 9\nline 10", excerpt(20, log))
+	require.Equal(t, "...", excerpt(5, log))
+	require.Equal(t, "", excerpt(2, log))
+}
+
+func TestExcerpts_budget(t *testing.T) {
+	long := joinLines(numbered(strings.Repeat("x", 990), 100))
+	jobs := []Job{
+		{Name: "short", RunnerLog: "--- FAIL: TestShort"},
+		{Name: "long1", RunnerLog: "panic: boom\n" + long},
+		{Name: "long2", RunnerLog: "panic: bang\n" + long},
+	}
+
+	total := 0
+	for _, e := range excerpts(jobs) {
+		require.NotEmpty(t, e.Log)
+		total += len(e.Log)
+	}
+	require.LessOrEqual(t, total, MaxLogSize)
+	require.Greater(t, total, MaxLogSize-3*1000)
+}
+
+func TestMakeLetter_excerpt(t *testing.T) {
+	n := renderNotifications["failed"]
+	n.Pipeline.FailedJobs = []Job{{
+		Name:      "race",
+		Stage:     "test",
+		RunnerLog: joinLines(numbered("\x1b[32mok", 30), []string{"WARNING: DATA RACE", "=================="}, numbered("\x1b[31mFAIL", 3)),
+	}}
+
+	letter, err := MakeLetter(&n)
+	require.NoError(t, err)
+	require.Contains(t, letter, `
+        Stage: test, Job race
+            ok 28
+            ok 29
+            ok 30
+            WARNING: DATA RACE
+            ==================
+            FAIL 1
+            FAIL 2
+            FAIL 3
+`)
+}
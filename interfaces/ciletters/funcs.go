@@ -0,0 +1,83 @@
+//go:build !solution
+
+package ciletters
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// Funcs returns the functions available to letter templates:
+//
+//	truncate N S   S cut to N runes, with "…" at the end if it was cut
+//	shortHash S    the 8 first characters of commit hash S
+//	tail N S       the last N lines of S without surrounding blank space
+//	indent N S     S with every line indented by N spaces
+//	duration D     D rounded to seconds, e.g. "1m30s"; D is a time.Duration or seconds
+//	excerpt N S    the failures found in job log S, cut to N bytes
+//	excerpts JOBS  the jobs with the excerpts of their logs in the Log field, together at most MaxLogSize bytes
+//	md S           S escaped for Markdown text
+//	fence S        a Markdown code fence that can enclose S
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		"truncate":  truncate,
+		"shortHash": shortHash,
+		"tail":      tailLines,
+		"indent":    indent,
+		"duration":  formatDuration,
+		"excerpt":   excerpt,
+		"excerpts":  excerpts,
+		"md":        escapeMarkdown,
+		"fence":     codeFence,
+	}
+}
+
+func truncate(n int, s string) string {
+	if n < 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n == 0 {
+		return ""
+	}
+
+	runes := 0
+	for i := range s {
+		if runes == n-1 {
+			return s[:i] + "…"
+		}
+		runes++
+	}
+	return s
+}
+
+func shortHash(hash string) string {
+	return hash[:min(8, len(hash))]
+}
+
+func tailLines(n int, s string) string {
+	lines := strings.Split(s, "\n")
+	return strings.TrimSpace(strings.Join(lines[max(0, len(lines)-n):], "\n"))
+}
+
+func indent(n int, s string) string {
+	prefix := strings.Repeat(" ", n)
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
+
+func formatDuration(d any) (string, error) {
+	switch d := d.(type) {
+	case time.Duration:
+		return d.Round(time.Second).String(), nil
+	case int:
+		return formatDuration(time.Duration(d) * time.Second)
+	case int64:
+		return formatDuration(time.Duration(d) * time.Second)
+	case float64:
+		return formatDuration(time.Duration(d * float64(time.Second)))
+	default:
+		return "", fmt.Errorf("duration: unsupported type %T", d)
+	}
+}
@@ -3,29 +3,38 @@
 package ciletters
 
 import (
-	_ "embed"
+	"embed"
 	"strings"
-	"text/template"
+	"sync"
 )
 
-//go:embed pattern.txt
-var pattern string
+// logLines is the number of the last lines of a job log included into a letter.
+const logLines = 10
 
-func MakeLetter(n *Notification) (string, error) {
-	var ans strings.Builder
+//go:embed pattern.txt pattern.md pattern.html
+var patterns embed.FS
 
-	funcMap := template.FuncMap{
-		"suffix": func(job Job) string {
-			output := strings.Split(job.RunnerLog, "\n")
-			return strings.TrimSpace(strings.Join(output[max(0, len(output)-10):], "\n"+strings.Repeat(" ", 12)))
-		},
+// defaultTemplates are the embedded templates, compiled on the first use.
+var defaultTemplates = sync.OnceValues(func() (*Templates, error) {
+	return LoadTemplates(patterns)
+})
+
+// defaultRenderer returns the renderer of the embedded template name.
+func defaultRenderer(name string) (*TemplateRenderer, error) {
+	t, err := defaultTemplates()
+	if err != nil {
+		return nil, err
 	}
+	return t.Renderer(name)
+}
 
-	tmpl, err := template.New("letter").Funcs(funcMap).Parse(pattern)
+func MakeLetter(n *Notification) (string, error) {
+	r, err := defaultRenderer("pattern.txt")
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
-	err = tmpl.Execute(&ans, n)
+	var ans strings.Builder
+	err = r.Render(&ans, n)
 	return ans.String(), err
 }
@@ -0,0 +1,128 @@
+//go:build !solution
+
+package ciletters
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Mail is an email with a plain text body and an optional HTML alternative.
+type Mail struct {
+	From    string
+	To      []string
+	Subject string
+
+	Text string
+	HTML string
+
+	// Date is the time of the Date header, the time of formatting if zero.
+	Date time.Time
+}
+
+// WriteTo writes the MIME message of m with CRLF line endings.
+func (m *Mail) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	header := func(key, value string) {
+		fmt.Fprintf(&b, "%s: %s\r\n", key, value)
+	}
+	header("From", formatAddress(m.From))
+	to := make([]string, len(m.To))
+	for i, addr := range m.To {
+		to[i] = formatAddress(addr)
+	}
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", messageID(m.From))
+	header("MIME-Version", "1.0")
+
+	if m.HTML == "" {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		b.WriteString("\r\n")
+		if err := writeQuotedPrintable(&b, m.Text); err != nil {
+			return 0, err
+		}
+	} else {
+		mw := multipart.NewWriter(&b)
+		header("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": mw.Boundary()}))
+		b.WriteString("\r\n")
+
+		for _, part := range []struct{ contentType, body string }{
+			{"text/plain; charset=utf-8", m.Text},
+			{"text/html; charset=utf-8", m.HTML},
+		} {
+			pw, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {part.contentType},
+				"Content-Transfer-Encoding": {"quoted-printable"},
+			})
+			if err != nil {
+				return 0, err
+			}
+			if err := writeQuotedPrintable(pw, part.body); err != nil {
+				return 0, err
+			}
+		}
+		if err := mw.Close(); err != nil {
+			return 0, err
+		}
+	}
+
+	return b.WriteTo(w)
+}
+
+// formatAddress encodes the name of an address like "Name <user@host>" if needed.
+func formatAddress(addr string) string {
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil {
+		return addr
+	}
+	return parsed.String()
+}
+
+func messageID(from string) string {
+	domain := "localhost"
+	if parsed, err := mail.ParseAddress(from); err == nil {
+		if _, host, ok := strings.Cut(parsed.Address, "@"); ok {
+			domain = host
+		}
+	}
+
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(id[:]), domain)
+}
+
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qw := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qw, text); err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+// envelopeAddress returns the bare "user@host" of addr for the SMTP envelope.
+func envelopeAddress(addr string) (string, error) {
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil {
+		return "", fmt.Errorf("ciletters: invalid address %q: %w", addr, err)
+	}
+	return parsed.Address, nil
+}
@@ -0,0 +1,115 @@
+//go:build !solution
+
+package ciletters
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Renderer renders a notification in some format.
+type Renderer interface {
+	// ContentType is the MIME type of the rendered letter.
+	ContentType() string
+	Render(w io.Writer, n *Notification) error
+}
+
+// Format names a Renderer.
+type Format string
+
+const (
+	FormatText     Format = "text"
+	FormatMarkdown Format = "markdown"
+	FormatHTML     Format = "html"
+	FormatSlack    Format = "slack"
+)
+
+var ErrUnknownFormat = errors.New("ciletters: unknown format")
+
+// NewRenderer returns the renderer of format f.
+func NewRenderer(f Format) (Renderer, error) {
+	switch f {
+	case FormatText:
+		return TextRenderer{}, nil
+	case FormatMarkdown:
+		return MarkdownRenderer{}, nil
+	case FormatHTML:
+		return HTMLRenderer{}, nil
+	case FormatSlack:
+		return SlackRenderer{}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, f)
+	}
+}
+
+// TextRenderer renders the plain text letter of MakeLetter.
+type TextRenderer struct{}
+
+func (TextRenderer) ContentType() string {
+	return "text/plain; charset=utf-8"
+}
+
+func (TextRenderer) Render(w io.Writer, n *Notification) error {
+	letter, err := MakeLetter(n)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, letter)
+	return err
+}
+
+// MarkdownRenderer renders a letter in CommonMark, e.g. for a merge request comment.
+type MarkdownRenderer struct{}
+
+func (MarkdownRenderer) ContentType() string {
+	return "text/markdown; charset=utf-8"
+}
+
+func (MarkdownRenderer) Render(w io.Writer, n *Notification) error {
+	r, err := defaultRenderer("pattern.md")
+	if err != nil {
+		return err
+	}
+	return r.Render(w, n)
+}
+
+// HTMLRenderer renders an HTML email. All fields of the notification are escaped.
+type HTMLRenderer struct{}
+
+func (HTMLRenderer) ContentType() string {
+	return "text/html; charset=utf-8"
+}
+
+func (HTMLRenderer) Render(w io.Writer, n *Notification) error {
+	r, err := defaultRenderer("pattern.html")
+	if err != nil {
+		return err
+	}
+	return r.Render(w, n)
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`,
+	`<`, `\<`, `>`, `\>`, `#`, `\#`, `|`, `\|`, `~`, `\~`,
+)
+
+// escapeMarkdown makes s render literally in Markdown text.
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+// codeFence returns a fence of backticks longer than any backtick run in code.
+func codeFence(code string) string {
+	longest, run := 0, 0
+	for _, r := range code {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
@@ -0,0 +1,157 @@
+package ciletters
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+var renderNotifications = map[string]Notification{
+	"success": {
+		Project: GitlabProject{GroupID: "go-spring-2021", ID: "gopher"},
+		Branch:  "master",
+		Commit: Commit{
+			Hash:    "2ff019bcb8f68d13d640e13351dad98edf7f1405",
+			Message: "Solve sum.",
+			Author:  "gopher",
+		},
+		Pipeline: Pipeline{Status: PipelineStatusOK, ID: 194555, TriggeredBy: "gopher"},
+	},
+	"failed": {
+		Project: GitlabProject{GroupID: "go-spring-2021", ID: "gopher"},
+		Branch:  "feature/<script>",
+		Commit: Commit{
+			Hash:    "8967153e8aa7b270af6447dae594eb87bdae8791",
+			Message: "Fix *bold* & <b>tags</b> in `code`.",
+			Author:  "gopher",
+		},
+		Pipeline: Pipeline{
+			Status:      PipelineStatusFailed,
+			ID:          194613,
+			TriggeredBy: "gopher",
+			FailedJobs: []Job{
+				{
+					ID:    202538,
+					Name:  "grade",
+					Stage: "test",
+					RunnerLog: `$ testtool grade
+testtool: running tests
+--- FAIL: TestSum (0.00s)
+    sum_test.go:19: 2 + 2 == 0 != 4
+    sum_test.go:19: "<nil>" != "&x"
+FAIL
+ERROR: Job failed: exit code 1`,
+				},
+				{
+					ID:        202539,
+					Name:      "lint",
+					Stage:     "check",
+					RunnerLog: "main.go:1: use ```fences``` in docs\nERROR: Job failed: exit code 1",
+				},
+			},
+		},
+	},
+}
+
+var goldenExt = map[Format]string{
+	FormatText:     ".txt",
+	FormatMarkdown: ".md",
+	FormatHTML:     ".html",
+	FormatSlack:    ".json",
+}
+
+func TestRender_golden(t *testing.T) {
+	for format, ext := range goldenExt {
+		r, err := NewRenderer(format)
+		require.NoError(t, err)
+
+		for name, n := range renderNotifications {
+			t.Run(string(format)+"/"+name, func(t *testing.T) {
+				var buf bytes.Buffer
+				require.NoError(t, r.Render(&buf, &n))
+
+				golden := filepath.Join("testdata", "render", name+ext)
+				if *update {
+					require.NoError(t, os.MkdirAll(filepath.Dir(golden), 0o755))
+					require.NoError(t, os.WriteFile(golden, buf.Bytes(), 0o644))
+				}
+
+				expected, err := os.ReadFile(golden)
+				require.NoError(t, err)
+				require.Equal(t, string(expected), buf.String())
+			})
+		}
+	}
+}
+
+func TestRender_text(t *testing.T) {
+	n := renderNotifications["failed"]
+
+	var buf bytes.Buffer
+	require.NoError(t, TextRenderer{}.Render(&buf, &n))
+
+	letter, err := MakeLetter(&n)
+	require.NoError(t, err)
+	require.Equal(t, letter, buf.String())
+}
+
+func TestRender_slackPayload(t *testing.T) {
+	n := renderNotifications["failed"]
+
+	var buf bytes.Buffer
+	require.NoError(t, SlackRenderer{}.Render(&buf, &n))
+
+	var payload struct {
+		Text   string
+		Blocks []json.RawMessage
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &payload))
+	require.NotEmpty(t, payload.Text)
+	require.Len(t, payload.Blocks, 2+len(n.Pipeline.FailedJobs))
+}
+
+func TestRender_slackLargeLog(t *testing.T) {
+	var log strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&log, "main.go:%d: <ошибка> & %s\n", i, strings.Repeat("строка ", 50))
+	}
+	log.WriteString("FAIL")
+
+	n := renderNotifications["failed"]
+	n.Pipeline.FailedJobs = []Job{{Name: "test", Stage: "test", RunnerLog: log.String()}}
+
+	var buf bytes.Buffer
+	require.NoError(t, SlackRenderer{}.Render(&buf, &n))
+
+	var payload struct {
+		Blocks []struct {
+			Text *struct{ Text string }
+		}
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &payload))
+
+	for _, block := range payload.Blocks {
+		if block.Text != nil {
+			require.LessOrEqual(t, utf8.RuneCountInString(block.Text.Text), 3000)
+		}
+	}
+
+	text := payload.Blocks[len(payload.Blocks)-1].Text.Text
+	require.Contains(t, text, "```\n…truncated\nmain.go:")
+	require.True(t, strings.HasSuffix(text, "FAIL\n```"), text)
+}
+
+func TestNewRenderer_unknown(t *testing.T) {
+	_, err := NewRenderer("pdf")
+	require.ErrorIs(t, err, ErrUnknownFormat)
+}
@@ -0,0 +1,289 @@
+//go:build !solution
+
+package ciletters
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoRecipients = errors.New("ciletters: no recipients")
+
+// RateLimitError is returned by Sender.Send when some recipients got too many letters.
+// The letter was sent to the other recipients.
+type RateLimitError struct {
+	Recipients []string
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("ciletters: rate limit exceeded for %s", strings.Join(e.Recipients, ", "))
+}
+
+// SenderOptions configures a Sender.
+type SenderOptions struct {
+	// Addr is the "host:port" of the SMTP server.
+	Addr string
+	// Auth is used if the server supports the AUTH extension, nil disables authentication.
+	Auth smtp.Auth
+	// From is the sender address, e.g. "CI <ci@example.com>".
+	From string
+
+	// Attempts is the number of attempts to send a letter, 1 if zero.
+	// Only temporary failures are retried.
+	Attempts int
+	// RetryDelay is the delay before the first retry, doubled for every next one.
+	RetryDelay time.Duration
+
+	// RecipientLimit letters are sent to a recipient per RecipientPeriod at most.
+	// Zero RecipientLimit disables the limit.
+	RecipientLimit  int
+	RecipientPeriod time.Duration
+}
+
+// Sender delivers letters over SMTP. It is safe for concurrent use.
+type Sender struct {
+	opts SenderOptions
+
+	mu   sync.Mutex
+	sent map[string][]time.Time
+	now  func() time.Time
+}
+
+// NewSender returns a sender configured by opts.
+func NewSender(opts SenderOptions) *Sender {
+	if opts.Attempts == 0 {
+		opts.Attempts = 1
+	}
+	return &Sender{opts: opts, sent: make(map[string][]time.Time), now: time.Now}
+}
+
+// SendNotification sends the plain text and HTML letters of n to the recipients.
+func (s *Sender) SendNotification(ctx context.Context, to []string, n *Notification) error {
+	text, err := MakeLetter(n)
+	if err != nil {
+		return err
+	}
+
+	var html strings.Builder
+	if err := (HTMLRenderer{}).Render(&html, n); err != nil {
+		return err
+	}
+
+	status := "passed"
+	if n.Pipeline.Status != PipelineStatusOK {
+		status = "failed"
+	}
+
+	return s.Send(ctx, &Mail{
+		To:      to,
+		Subject: fmt.Sprintf("%s/%s | Pipeline #%d %s on %s", n.Project.GroupID, n.Project.ID, n.Pipeline.ID, status, n.Branch),
+		Text:    text,
+		HTML:    html.String(),
+	})
+}
+
+// Send delivers m. The From of m defaults to SenderOptions.From.
+//
+// Recipients over the rate limit are skipped and reported by *RateLimitError.
+// A letter that failed to send does not count against the limit.
+func (s *Sender) Send(ctx context.Context, m *Mail) error {
+	mail := *m
+	if mail.From == "" {
+		mail.From = s.opts.From
+	}
+
+	allowed, limited, at := s.allow(mail.To)
+	var errLimit error
+	if len(limited) != 0 {
+		errLimit = &RateLimitError{Recipients: limited}
+	}
+	if len(allowed) == 0 {
+		if errLimit == nil {
+			return ErrNoRecipients
+		}
+		return errLimit
+	}
+	mail.To = allowed
+
+	delivered := false
+	defer func() {
+		if !delivered {
+			s.refund(allowed, at)
+		}
+	}()
+
+	var msg bytes.Buffer
+	if _, err := mail.WriteTo(&msg); err != nil {
+		return err
+	}
+
+	from, err := envelopeAddress(mail.From)
+	if err != nil {
+		return err
+	}
+	rcpts := make([]string, len(allowed))
+	for i, addr := range allowed {
+		if rcpts[i], err = envelopeAddress(addr); err != nil {
+			return err
+		}
+	}
+
+	delay := s.opts.RetryDelay
+	for attempt := 1; ; attempt++ {
+		err = s.deliver(ctx, from, rcpts, msg.Bytes())
+		if err == nil || attempt == s.opts.Attempts || !isTemporary(err) {
+			break
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+
+	if err != nil {
+		return fmt.Errorf("ciletters: send mail: %w", err)
+	}
+	delivered = true
+	return errLimit
+}
+
+// allow splits the recipients into the ones within the rate limit and the rest,
+// and records the letter for the former at the returned time. The letter is recorded
+// before it is sent, so that concurrent letters can not exceed the limit,
+// and is refunded if sending fails.
+func (s *Sender) allow(to []string) (allowed, limited []string, now time.Time) {
+	if s.opts.RecipientLimit == 0 {
+		return to, nil, now
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now = s.now()
+	for _, addr := range to {
+		key := strings.ToLower(addr)
+
+		sent := s.sent[key]
+		for len(sent) != 0 && now.Sub(sent[0]) >= s.opts.RecipientPeriod {
+			sent = sent[1:]
+		}
+
+		if len(sent) >= s.opts.RecipientLimit {
+			limited = append(limited, addr)
+		} else {
+			allowed = append(allowed, addr)
+			sent = append(sent, now)
+		}
+
+		if len(sent) == 0 {
+			delete(s.sent, key)
+		} else {
+			s.sent[key] = sent
+		}
+	}
+	return allowed, limited, now
+}
+
+// refund forgets the letter recorded by allow at the given time for the recipients.
+func (s *Sender) refund(to []string, at time.Time) {
+	if s.opts.RecipientLimit == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, addr := range to {
+		key := strings.ToLower(addr)
+
+		sent := s.sent[key]
+		for i := len(sent) - 1; i >= 0; i-- {
+			if sent[i].Equal(at) {
+				sent = slices.Delete(sent, i, i+1)
+				break
+			}
+		}
+
+		if len(sent) == 0 {
+			delete(s.sent, key)
+		} else {
+			s.sent[key] = sent
+		}
+	}
+}
+
+func (s *Sender) deliver(ctx context.Context, from string, to []string, msg []byte) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.opts.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	host, _, _ := net.SplitHostPort(s.opts.Addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if s.opts.Auth != nil {
+		if ok, _ := c.Extension("AUTH"); ok {
+			if err := c.Auth(s.opts.Auth); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	// The message is accepted once DATA is, a failed QUIT must not make it sent again.
+	_ = c.Quit()
+	return nil
+}
+
+// isTemporary reports whether a failed delivery may succeed later:
+// network errors, dropped connections and 4xx replies are temporary, 5xx replies are not.
+func isTemporary(err error) bool {
+	var errReply *textproto.Error
+	if errors.As(err, &errReply) {
+		return errReply.Code >= 400 && errReply.Code < 500
+	}
+
+	var errNet net.Error
+	return errors.As(err, &errNet) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
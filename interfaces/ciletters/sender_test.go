@@ -0,0 +1,260 @@
+package ciletters
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"gitlab.com/slon/shad-go/ciletters/smtptest"
+)
+
+// parseMail returns the headers and the decoded parts of a message by content type.
+func parseMail(t *testing.T, data []byte) (mail.Header, map[string]string) {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	decode := func(r io.Reader) string {
+		body, err := io.ReadAll(quotedprintable.NewReader(r))
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+
+	parts := make(map[string]string)
+	if mediaType != "multipart/alternative" {
+		parts[mediaType] = decode(msg.Body)
+		return msg.Header, parts
+	}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		partType, _, err := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		parts[partType] = decode(p)
+	}
+	return msg.Header, parts
+}
+
+func TestMail(t *testing.T) {
+	m := &Mail{
+		From:    "Пайплайн <ci@example.com>",
+		To:      []string{"a@example.com", "B <b@example.com>"},
+		Subject: "Сборка упала",
+		Text:    "line 1\nстрока 2 " + string(bytes.Repeat([]byte("x"), 100)),
+		HTML:    "<p>line 1</p>",
+		Date:    time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	var buf bytes.Buffer
+	_, err := m.WriteTo(&buf)
+	require.NoError(t, err)
+
+	for _, line := range bytes.Split(buf.Bytes(), []byte("\r\n")) {
+		require.LessOrEqual(t, len(line), 998)
+		require.NotContains(t, string(line), "\n")
+	}
+
+	header, parts := parseMail(t, buf.Bytes())
+
+	from, err := header.AddressList("From")
+	require.NoError(t, err)
+	require.Equal(t, []*mail.Address{{Name: "Пайплайн", Address: "ci@example.com"}}, from)
+
+	to, err := header.AddressList("To")
+	require.NoError(t, err)
+	require.Equal(t, []*mail.Address{{Address: "a@example.com"}, {Name: "B", Address: "b@example.com"}}, to)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	require.NoError(t, err)
+	require.Equal(t, m.Subject, subject)
+
+	date, err := header.Date()
+	require.NoError(t, err)
+	require.True(t, m.Date.Equal(date))
+	require.Contains(t, header.Get("Message-ID"), "@example.com>")
+
+	require.Equal(t, map[string]string{
+		"text/plain": "line 1\r\nстрока 2 " + string(bytes.Repeat([]byte("x"), 100)),
+		"text/html":  "<p>line 1</p>",
+	}, parts)
+}
+
+func TestMail_textOnly(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := (&Mail{From: "ci@example.com", To: []string{"a@example.com"}, Text: "hello"}).WriteTo(&buf)
+	require.NoError(t, err)
+
+	_, parts := parseMail(t, buf.Bytes())
+	require.Equal(t, map[string]string{"text/plain": "hello"}, parts)
+}
+
+func newSMTPServer(t *testing.T) *smtptest.Server {
+	t.Helper()
+
+	s, err := smtptest.NewServer()
+	require.NoError(t, err)
+	return s
+}
+
+func TestSender_sendNotification(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	s := newSMTPServer(t)
+	defer func() { require.NoError(t, s.Close()) }()
+	sender := NewSender(SenderOptions{Addr: s.Addr, From: "CI <ci@example.com>"})
+
+	n := renderNotifications["failed"]
+	require.NoError(t, sender.SendNotification(context.Background(), []string{"gopher@example.com"}, &n))
+
+	messages := s.Messages()
+	require.Len(t, messages, 1)
+	require.Equal(t, "ci@example.com", messages[0].From)
+	require.Equal(t, []string{"gopher@example.com"}, messages[0].To)
+
+	header, parts := parseMail(t, messages[0].Data)
+	require.Equal(t, "go-spring-2021/gopher | Pipeline #194613 failed on feature/<script>", header.Get("Subject"))
+
+	letter, err := MakeLetter(&n)
+	require.NoError(t, err)
+	require.Equal(t, letter, normalizeCRLF(parts["text/plain"]))
+
+	var html bytes.Buffer
+	require.NoError(t, HTMLRenderer{}.Render(&html, &n))
+	require.Equal(t, html.String(), normalizeCRLF(parts["text/html"]))
+}
+
+func normalizeCRLF(s string) string {
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
+
+func TestSender_retry(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	s := newSMTPServer(t)
+	defer func() { require.NoError(t, s.Close()) }()
+	sender := NewSender(SenderOptions{Addr: s.Addr, From: "ci@example.com", Attempts: 3, RetryDelay: time.Millisecond})
+
+	m := &Mail{To: []string{"a@example.com"}, Text: "hello"}
+
+	s.FailNext(2, 421, "service not available")
+	require.NoError(t, sender.Send(context.Background(), m))
+	require.Len(t, s.Messages(), 1)
+
+	s.FailNext(3, 451, "try again later")
+	require.Error(t, sender.Send(context.Background(), m))
+	require.Len(t, s.Messages(), 1)
+
+	s.FailNext(1, 550, "mailbox unavailable")
+	require.Error(t, sender.Send(context.Background(), m))
+	require.NoError(t, sender.Send(context.Background(), m), "permanent failures must not be retried")
+	require.Len(t, s.Messages(), 2)
+}
+
+func TestSender_quitDropped(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	s := newSMTPServer(t)
+	defer func() { require.NoError(t, s.Close()) }()
+	sender := NewSender(SenderOptions{Addr: s.Addr, From: "ci@example.com", Attempts: 3, RetryDelay: time.Millisecond})
+
+	s.DropNextQuit(1)
+	require.NoError(t, sender.Send(context.Background(), &Mail{To: []string{"a@example.com"}, Text: "hello"}))
+	require.Len(t, s.Messages(), 1, "a letter accepted by DATA must not be sent again")
+}
+
+func TestSender_retryCanceled(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	s := newSMTPServer(t)
+	defer func() { require.NoError(t, s.Close()) }()
+	sender := NewSender(SenderOptions{Addr: s.Addr, From: "ci@example.com", Attempts: 3, RetryDelay: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	s.FailNext(1, 421, "service not available")
+	err := sender.Send(ctx, &Mail{To: []string{"a@example.com"}, Text: "hello"})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestSender_rateLimit(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	s := newSMTPServer(t)
+	defer func() { require.NoError(t, s.Close()) }()
+	sender := NewSender(SenderOptions{Addr: s.Addr, From: "ci@example.com", RecipientLimit: 2, RecipientPeriod: time.Minute})
+
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	sender.now = func() time.Time { return now }
+
+	send := func(to ...string) error {
+		return sender.Send(context.Background(), &Mail{To: to, Text: "hello"})
+	}
+
+	require.NoError(t, send("a@example.com"))
+	require.NoError(t, send("A@example.com", "b@example.com"))
+
+	err := send("a@example.com", "b@example.com")
+	var errLimit *RateLimitError
+	require.ErrorAs(t, err, &errLimit)
+	require.Equal(t, []string{"a@example.com"}, errLimit.Recipients)
+
+	err = send("a@example.com")
+	require.ErrorAs(t, err, &errLimit)
+
+	now = now.Add(time.Minute)
+	require.NoError(t, send("a@example.com"))
+
+	var to [][]string
+	for _, m := range s.Messages() {
+		to = append(to, m.To)
+	}
+	require.Equal(t, [][]string{
+		{"a@example.com"},
+		{"A@example.com", "b@example.com"},
+		{"b@example.com"},
+		{"a@example.com"},
+	}, to)
+
+	require.ErrorIs(t, send(), ErrNoRecipients)
+}
+
+func TestSender_rateLimitRefund(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	s := newSMTPServer(t)
+	defer func() { require.NoError(t, s.Close()) }()
+	sender := NewSender(SenderOptions{Addr: s.Addr, From: "ci@example.com", RecipientLimit: 1, RecipientPeriod: time.Minute})
+
+	send := func() error {
+		return sender.Send(context.Background(), &Mail{To: []string{"a@example.com"}, Text: "hello"})
+	}
+
+	s.FailNext(1, 550, "mailbox unavailable")
+	require.Error(t, send())
+	require.NoError(t, send(), "a failed letter must not count against the limit")
+
+	var errLimit *RateLimitError
+	require.ErrorAs(t, send(), &errLimit)
+	require.Len(t, s.Messages(), 1)
+}
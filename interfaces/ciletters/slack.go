@@ -0,0 +1,118 @@
+//go:build !solution
+
+package ciletters
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// SlackRenderer renders a chat webhook payload in the format of Slack incoming webhooks.
+type SlackRenderer struct{}
+
+type (
+	slackMessage struct {
+		// Text is the fallback shown in notifications.
+		Text   string       `json:"text"`
+		Blocks []slackBlock `json:"blocks"`
+	}
+
+	slackBlock struct {
+		Type   string      `json:"type"`
+		Text   *slackText  `json:"text,omitempty"`
+		Fields []slackText `json:"fields,omitempty"`
+	}
+
+	slackText struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+)
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func mrkdwn(format string, args ...any) slackText {
+	for i, arg := range args {
+		if s, ok := arg.(string); ok {
+			args[i] = slackEscaper.Replace(s)
+		}
+	}
+	return slackText{Type: "mrkdwn", Text: fmt.Sprintf(format, args...)}
+}
+
+func (SlackRenderer) ContentType() string {
+	return "application/json"
+}
+
+func (SlackRenderer) Render(w io.Writer, n *Notification) error {
+	status := ":white_check_mark: Pipeline #%d passed!"
+	if n.Pipeline.Status != PipelineStatusOK {
+		status = ":x: Pipeline #%d has failed!"
+	}
+	title := fmt.Sprintf(status, n.Pipeline.ID)
+
+	msg := slackMessage{
+		Text: fmt.Sprintf("%s %s/%s@%s", title, n.Project.GroupID, n.Project.ID, n.Branch),
+		Blocks: []slackBlock{
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: "*" + title + "*"}},
+			{Type: "section", Fields: []slackText{
+				mrkdwn("*Project:*\n%s/%s", n.Project.GroupID, n.Project.ID),
+				mrkdwn("*Branch:*\n🌿 %s", n.Branch),
+				mrkdwn("*Commit:*\n`%s` %s", shortHash(n.Commit.Hash), n.Commit.Message),
+				mrkdwn("*CommitAuthor:*\n%s", n.Commit.Author),
+			}},
+		},
+	}
+
+	for _, job := range excerpts(n.Pipeline.FailedJobs) {
+		title := mrkdwn("*Stage: %s, Job %s*", job.Stage, job.Name).Text
+		msg.Blocks = append(msg.Blocks, slackBlock{
+			Type: "section",
+			Text: &slackText{Type: "mrkdwn", Text: slackLogSection(title, job.Log)},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(msg)
+}
+
+// slackTextLimit is the maximum length of a section text in characters, Slack rejects longer ones.
+const slackTextLimit = 3000
+
+const slackTruncated = "…truncated"
+
+// slackLogSection formats the title and the log in a code block. The log is cut
+// from the start to fit the section into slackTextLimit, as its end is the most relevant.
+func slackLogSection(title, log string) string {
+	const fenceOpen, fenceClose = "\n```\n", "\n```"
+
+	escaped := slackEscaper.Replace(log)
+	text := title + fenceOpen + escaped + fenceClose
+	if utf8.RuneCountInString(text) <= slackTextLimit {
+		return text
+	}
+
+	budget := slackTextLimit - utf8.RuneCountInString(title+fenceOpen+slackTruncated+"\n"+fenceClose)
+	start := len(log)
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(log[:start])
+		cost := utf8.RuneCountInString(slackEscaper.Replace(string(r)))
+		if cost > budget {
+			break
+		}
+		budget -= cost
+		start -= size
+	}
+
+	// Prefer to keep whole lines.
+	tail := log[start:]
+	if i := strings.IndexByte(tail, '\n'); i >= 0 && i+1 < len(tail) && start > 0 && log[start-1] != '\n' {
+		tail = tail[i+1:]
+	}
+	return title + fenceOpen + slackTruncated + "\n" + slackEscaper.Replace(tail) + fenceClose
+}
@@ -0,0 +1,252 @@
+//go:build !solution
+
+// Package smtptest provides an in-process SMTP server for tests.
+package smtptest
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// Message is a message accepted by the server.
+type Message struct {
+	From string
+	To   []string
+	// Data is the message with headers, CRLF line endings and without the final dot.
+	Data []byte
+}
+
+// Server is an SMTP server that stores all messages in memory.
+//
+// It implements the commands needed by net/smtp: HELO, EHLO, MAIL, RCPT, DATA, RSET, NOOP and QUIT.
+type Server struct {
+	// Addr is the address of the server, "127.0.0.1:port".
+	Addr string
+
+	l  net.Listener
+	wg sync.WaitGroup
+
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	messages []Message
+	failures []*textproto.Error
+	drops    int
+}
+
+// NewServer starts a server on a random local port.
+func NewServer() (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{Addr: l.Addr().String(), l: l, conns: make(map[net.Conn]struct{})}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Messages returns the accepted messages in the order of arrival.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// FailNext makes the server reject the next n transactions with the given reply,
+// e.g. 421 for a temporary failure or 550 for a permanent one.
+func (s *Server) FailNext(n int, code int, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, &textproto.Error{Code: code, Msg: msg})
+	}
+}
+
+// DropNextQuit makes the server close the next n connections on QUIT without a reply,
+// as if the connection was lost after the message was accepted.
+func (s *Server) DropNextQuit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drops += n
+}
+
+// nextDrop reports whether the connection must be dropped on QUIT.
+func (s *Server) nextDrop() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.drops == 0 {
+		return false
+	}
+	s.drops--
+	return true
+}
+
+// Close stops the server and waits for the connections to finish.
+func (s *Server) Close() error {
+	err := s.l.Close()
+
+	s.mu.Lock()
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		c, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, c)
+				s.mu.Unlock()
+				_ = c.Close()
+			}()
+
+			_ = s.handle(textproto.NewConn(c))
+		}()
+	}
+}
+
+// nextFailure pops the failure of the current transaction.
+func (s *Server) nextFailure() *textproto.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.failures) == 0 {
+		return nil
+	}
+	err := s.failures[0]
+	s.failures = s.failures[1:]
+	return err
+}
+
+var errQuit = errors.New("quit")
+
+func (s *Server) handle(c *textproto.Conn) error {
+	if err := c.PrintfLine("220 smtptest ESMTP"); err != nil {
+		return err
+	}
+
+	var msg *Message
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return err
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			err = c.PrintfLine("250 smtptest")
+		case "EHLO":
+			err = c.PrintfLine("250-smtptest\r\n250 8BITMIME")
+		case "NOOP":
+			err = c.PrintfLine("250 OK")
+		case "RSET":
+			msg = nil
+			err = c.PrintfLine("250 OK")
+		case "QUIT":
+			if !s.nextDrop() {
+				_ = c.PrintfLine("221 Bye")
+			}
+			return errQuit
+
+		case "MAIL":
+			from, ok := parsePath(arg, "FROM:")
+			switch {
+			case !ok:
+				err = c.PrintfLine("501 Syntax error")
+			case msg != nil:
+				err = c.PrintfLine("503 Nested MAIL command")
+			default:
+				if failure := s.nextFailure(); failure != nil {
+					err = c.PrintfLine("%d %s", failure.Code, failure.Msg)
+					break
+				}
+				msg = &Message{From: from}
+				err = c.PrintfLine("250 OK")
+			}
+
+		case "RCPT":
+			to, ok := parsePath(arg, "TO:")
+			switch {
+			case !ok:
+				err = c.PrintfLine("501 Syntax error")
+			case msg == nil:
+				err = c.PrintfLine("503 Need MAIL command")
+			default:
+				msg.To = append(msg.To, to)
+				err = c.PrintfLine("250 OK")
+			}
+
+		case "DATA":
+			if msg == nil || len(msg.To) == 0 {
+				err = c.PrintfLine("503 Need RCPT command")
+				break
+			}
+			if err := c.PrintfLine("354 End data with <CR><LF>.<CR><LF>"); err != nil {
+				return err
+			}
+
+			data, err := c.ReadDotBytes()
+			if err != nil {
+				return err
+			}
+			msg.Data = toCRLF(data)
+
+			s.mu.Lock()
+			s.messages = append(s.messages, *msg)
+			s.mu.Unlock()
+
+			msg = nil
+			err = c.PrintfLine("250 OK")
+
+		default:
+			err = c.PrintfLine("502 Command not implemented")
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parsePath parses "FROM:<addr> PARAMS" of MAIL and "TO:<addr>" of RCPT.
+func parsePath(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+
+	path, _, _ := strings.Cut(strings.TrimSpace(arg[len(prefix):]), " ")
+	if !strings.HasPrefix(path, "<") || !strings.HasSuffix(path, ">") {
+		return "", false
+	}
+	return path[1 : len(path)-1], true
+}
+
+// toCRLF restores the line endings converted by ReadDotBytes.
+func toCRLF(data []byte) []byte {
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
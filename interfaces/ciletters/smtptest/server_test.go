@@ -0,0 +1,79 @@
+package smtptest_test
+
+import (
+	"net/smtp"
+	"net/textproto"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"gitlab.com/slon/shad-go/ciletters/smtptest"
+)
+
+func TestServer(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	s, err := smtptest.NewServer()
+	require.NoError(t, err)
+	defer func() { require.NoError(t, s.Close()) }()
+
+	msg := "Subject: hi\r\n\r\n.leading dot\r\nbye\r\n"
+	require.NoError(t, smtp.SendMail(s.Addr, nil, "ci@example.com", []string{"a@example.com", "b@example.com"}, []byte(msg)))
+
+	require.Equal(t, []smtptest.Message{{
+		From: "ci@example.com",
+		To:   []string{"a@example.com", "b@example.com"},
+		Data: []byte(msg),
+	}}, s.Messages())
+}
+
+func TestServer_failNext(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	s, err := smtptest.NewServer()
+	require.NoError(t, err)
+	defer func() { require.NoError(t, s.Close()) }()
+
+	s.FailNext(1, 451, "try again later")
+
+	err = smtp.SendMail(s.Addr, nil, "ci@example.com", []string{"a@example.com"}, []byte("\r\n"))
+	var errReply *textproto.Error
+	require.ErrorAs(t, err, &errReply)
+	require.Equal(t, 451, errReply.Code)
+	require.Empty(t, s.Messages())
+
+	require.NoError(t, smtp.SendMail(s.Addr, nil, "ci@example.com", []string{"a@example.com"}, []byte("\r\n")))
+	require.Len(t, s.Messages(), 1)
+}
+
+func TestServer_dropNextQuit(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	s, err := smtptest.NewServer()
+	require.NoError(t, err)
+	defer func() { require.NoError(t, s.Close()) }()
+
+	s.DropNextQuit(1)
+
+	err = smtp.SendMail(s.Addr, nil, "ci@example.com", []string{"a@example.com"}, []byte("\r\n"))
+	require.Error(t, err)
+	require.Len(t, s.Messages(), 1)
+
+	require.NoError(t, smtp.SendMail(s.Addr, nil, "ci@example.com", []string{"a@example.com"}, []byte("\r\n")))
+	require.Len(t, s.Messages(), 2)
+}
+
+func TestServer_closeActiveConnection(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	s, err := smtptest.NewServer()
+	require.NoError(t, err)
+
+	c, err := smtp.Dial(s.Addr)
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.Hello("localhost"))
+	require.NoError(t, s.Close())
+}
@@ -0,0 +1,160 @@
+//go:build !solution
+
+package ciletters
+
+import (
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"text/template"
+)
+
+var ErrUnknownTemplate = errors.New("ciletters: unknown template")
+
+// TemplateError is returned by LoadTemplates for a template that fails to parse
+// or to render the sample notifications.
+type TemplateError struct {
+	Name string
+	Err  error
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("ciletters: template %s: %v", e.Name, e.Err)
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// executor is implemented by both text/template and html/template templates.
+type executor interface {
+	Execute(w io.Writer, data any) error
+}
+
+// TemplateRenderer renders a notification with a template loaded by LoadTemplates.
+type TemplateRenderer struct {
+	tmpl        executor
+	contentType string
+}
+
+func (r *TemplateRenderer) ContentType() string {
+	return r.contentType
+}
+
+func (r *TemplateRenderer) Render(w io.Writer, n *Notification) error {
+	return r.tmpl.Execute(w, n)
+}
+
+// Templates is a set of compiled letter templates.
+type Templates struct {
+	renderers map[string]*TemplateRenderer
+}
+
+// Renderer returns the renderer of the template with the given file name, e.g. "pattern.txt".
+func (t *Templates) Renderer(name string) (*TemplateRenderer, error) {
+	r, ok := t.renderers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTemplate, name)
+	}
+	return r, nil
+}
+
+// Names returns the sorted names of the templates.
+func (t *Templates) Names() []string {
+	names := make([]string, 0, len(t.renderers))
+	for name := range t.renderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var templateTypes = map[string]string{
+	".txt":  "text/plain; charset=utf-8",
+	".md":   "text/markdown; charset=utf-8",
+	".html": "text/html; charset=utf-8",
+}
+
+// LoadTemplates compiles the *.txt, *.md and *.html files at the root of fsys.
+// HTML templates are compiled with html/template and escape their output.
+// Templates can call the functions of Funcs.
+//
+// Every template is validated by rendering sample notifications of all kinds,
+// so a template referring to a field missing from Notification fails to load.
+func LoadTemplates(fsys fs.FS) (*Templates, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{renderers: make(map[string]*TemplateRenderer)}
+	for _, e := range entries {
+		contentType, ok := templateTypes[path.Ext(e.Name())]
+		if e.IsDir() || !ok {
+			continue
+		}
+
+		r, err := loadTemplate(fsys, e.Name(), contentType, sampleNotifications)
+		if err != nil {
+			return nil, &TemplateError{Name: e.Name(), Err: err}
+		}
+		t.renderers[e.Name()] = r
+	}
+	return t, nil
+}
+
+// LoadTemplatesDir is LoadTemplates of a directory.
+func LoadTemplatesDir(dir string) (*Templates, error) {
+	return LoadTemplates(os.DirFS(dir))
+}
+
+// loadTemplate compiles the template and validates it by executing on samples.
+func loadTemplate[T any](fsys fs.FS, name, contentType string, samples []T) (*TemplateRenderer, error) {
+	text, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var tmpl executor
+	if path.Ext(name) == ".html" {
+		tmpl, err = htmltemplate.New(name).Funcs(htmltemplate.FuncMap(Funcs())).Parse(string(text))
+	} else {
+		tmpl, err = template.New(name).Funcs(Funcs()).Parse(string(text))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range samples {
+		if err := tmpl.Execute(io.Discard, &samples[i]); err != nil {
+			return nil, err
+		}
+	}
+	return &TemplateRenderer{tmpl: tmpl, contentType: contentType}, nil
+}
+
+// sampleNotifications cover the branches a template may take on a notification.
+var sampleNotifications = []Notification{
+	{
+		Project:  GitlabProject{GroupID: "group", ID: "project"},
+		Branch:   "main",
+		Commit:   Commit{Hash: "0123456789abcdef0123456789abcdef01234567", Message: "Message.", Author: "author"},
+		Pipeline: Pipeline{Status: PipelineStatusOK, ID: 1, TriggeredBy: "author"},
+	},
+	{
+		Project: GitlabProject{GroupID: "group", ID: "project"},
+		Branch:  "main",
+		Commit:  Commit{Hash: "0123456789abcdef0123456789abcdef01234567", Message: "Message.", Author: "author"},
+		Pipeline: Pipeline{
+			Status:      PipelineStatusFailed,
+			ID:          2,
+			TriggeredBy: "author",
+			FailedJobs:  []Job{{ID: 1, Name: "job", Stage: "test", RunnerLog: "log"}},
+		},
+	},
+}
@@ -0,0 +1,109 @@
+package ciletters
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadTemplates(t *testing.T) {
+	fsys := fstest.MapFS{
+		"short.txt":      {Data: []byte(`{{ .Project.ID }}@{{ shortHash .Commit.Hash }}: {{ truncate 5 .Commit.Message }}`)},
+		"short.html":     {Data: []byte(`<b>{{ .Commit.Message }}</b>`)},
+		"README":         {Data: []byte(`not a template`)},
+		"sub/nested.txt": {Data: []byte(`{{ .Missing }}`)},
+	}
+
+	tmpls, err := LoadTemplates(fsys)
+	require.NoError(t, err)
+	require.Equal(t, []string{"short.html", "short.txt"}, tmpls.Names())
+
+	n := renderNotifications["failed"]
+
+	r, err := tmpls.Renderer("short.txt")
+	require.NoError(t, err)
+	require.Equal(t, "text/plain; charset=utf-8", r.ContentType())
+
+	var buf bytes.Buffer
+	require.NoError(t, r.Render(&buf, &n))
+	require.Equal(t, "gopher@8967153e: Fix …", buf.String())
+
+	r, err = tmpls.Renderer("short.html")
+	require.NoError(t, err)
+	require.Equal(t, "text/html; charset=utf-8", r.ContentType())
+
+	buf.Reset()
+	require.NoError(t, r.Render(&buf, &n))
+	require.Equal(t, "<b>Fix *bold* &amp; &lt;b&gt;tags&lt;/b&gt; in `code`.</b>", buf.String())
+
+	_, err = tmpls.Renderer("pattern.txt")
+	require.ErrorIs(t, err, ErrUnknownTemplate)
+}
+
+func TestLoadTemplates_dir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "letter.md"), []byte(`**{{ .Branch }}**`), 0o644))
+
+	tmpls, err := LoadTemplatesDir(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"letter.md"}, tmpls.Names())
+}
+
+func TestLoadTemplates_invalid(t *testing.T) {
+	for _, tc := range []struct {
+		name, text string
+	}{
+		{name: "syntax", text: `{{ if }}`},
+		{name: "unknownFunc", text: `{{ suffix . }}`},
+		{name: "unknownField", text: `{{ .Pipeline.Duration }}`},
+		{name: "unknownFieldInFailedBranch", text: `{{ if eq .Pipeline.Status "ok" }}ok{{ else }}{{ .Pipeline.Reason }}{{ end }}`},
+		{name: "unknownJobField", text: `{{ range .Pipeline.FailedJobs }}{{ .Log }}{{ end }}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := LoadTemplates(fstest.MapFS{"letter.txt": {Data: []byte(tc.text)}})
+
+			var errTemplate *TemplateError
+			require.ErrorAs(t, err, &errTemplate)
+			require.Equal(t, "letter.txt", errTemplate.Name)
+		})
+	}
+}
+
+func TestFuncs(t *testing.T) {
+	require.Equal(t, "héllo", truncate(5, "héllo"))
+	require.Equal(t, "hé…", truncate(3, "héllo"))
+	require.Equal(t, "", truncate(0, "héllo"))
+
+	require.Equal(t, "8967153e", shortHash("8967153e8aa7b270af6447dae594eb87bdae8791"))
+	require.Equal(t, "abc", shortHash("abc"))
+
+	log := strings.Join([]string{"1", "2", "3", "4", ""}, "\n")
+	require.Equal(t, "3\n4", tailLines(3, log))
+	require.Equal(t, "1\n2\n3\n4", tailLines(100, log))
+
+	require.Equal(t, "  a\n  b", indent(2, "a\nb"))
+
+	for _, tc := range []struct {
+		in       any
+		expected string
+	}{
+		{in: 90 * time.Second, expected: "1m30s"},
+		{in: 1500 * time.Millisecond, expected: "2s"},
+		{in: 3661, expected: "1h1m1s"},
+		{in: int64(5), expected: "5s"},
+		{in: 0.4, expected: "0s"},
+	} {
+		d, err := formatDuration(tc.in)
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, d)
+	}
+
+	_, err := formatDuration("1s")
+	require.Error(t, err)
+}
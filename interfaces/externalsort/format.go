@@ -0,0 +1,179 @@
+//go:build !solution
+
+package externalsort
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Format describes how lines are laid out in a stream.
+type Format int
+
+const (
+	// FormatText is newline-delimited text, as read by NewReader.
+	FormatText Format = iota
+	// FormatCRLF is text where lines may end with "\r\n".
+	// Lines are written with "\r\n" terminators.
+	FormatCRLF
+	// FormatRecord is a sequence of length-prefixed records.
+	// Each record is a uvarint length followed by that many bytes,
+	// so records may contain arbitrary bytes including '\n'.
+	FormatRecord
+)
+
+// NewReader wraps r in a LineReader that understands format f.
+func (f Format) NewReader(r io.Reader) LineReader {
+	switch f {
+	case FormatCRLF:
+		return NewCRLFReader(r)
+	case FormatRecord:
+		return NewRecordReader(r)
+	default:
+		return NewReader(r)
+	}
+}
+
+// NewWriter wraps w in a LineWriter that produces format f.
+func (f Format) NewWriter(w io.Writer) LineWriter {
+	switch f {
+	case FormatCRLF:
+		return NewCRLFWriter(w)
+	case FormatRecord:
+		return NewRecordWriter(w)
+	default:
+		return NewWriter(w)
+	}
+}
+
+// Compression selects how spilled runs are compressed on disk.
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+)
+
+func (c Compression) newReader(r io.Reader) (io.Reader, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	default:
+		return r, nil
+	}
+}
+
+func (c Compression) newWriter(w io.Writer) io.WriteCloser {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewWriter(w)
+	default:
+		return nopWriteCloser{w}
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+type CRLFLineReader struct {
+	reader LineReader
+}
+
+func (r *CRLFLineReader) ReadLine() (string, error) {
+	line, err := r.reader.ReadLine()
+	return strings.TrimSuffix(line, "\r"), err
+}
+
+// NewCRLFReader is like NewReader, but also strips '\r' preceding the line break.
+func NewCRLFReader(r io.Reader) LineReader {
+	return &CRLFLineReader{reader: NewReader(r)}
+}
+
+type CRLFLineWriter struct {
+	writer io.Writer
+}
+
+func (w *CRLFLineWriter) Write(l string) error {
+	_, err := io.WriteString(w.writer, l+"\r\n")
+	return err
+}
+
+func NewCRLFWriter(w io.Writer) LineWriter {
+	return &CRLFLineWriter{writer: w}
+}
+
+// MaxRecordSize is the maximum length of a FormatRecord record.
+const MaxRecordSize = 1 << 30
+
+// ErrRecordTooLarge is returned for records longer than MaxRecordSize,
+// it usually means that the stream is corrupt.
+var ErrRecordTooLarge = errors.New("record is too large")
+
+type RecordReader struct {
+	reader *bufio.Reader
+}
+
+func (r *RecordReader) ReadLine() (string, error) {
+	size, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", io.EOF
+		}
+		return "", fmt.Errorf("error while reading record length: %w", err)
+	}
+
+	if size > MaxRecordSize {
+		return "", fmt.Errorf("error while reading record: length %d: %w", size, ErrRecordTooLarge)
+	}
+
+	// The length is not trusted to preallocate the record, a truncated stream
+	// must not cost more memory than its actual size.
+	var ans strings.Builder
+	if _, err := io.CopyN(&ans, r.reader, int64(size)); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", fmt.Errorf("error while reading record: %w", err)
+	}
+
+	return ans.String(), nil
+}
+
+// NewRecordReader wraps r in a LineReader that reads FormatRecord records.
+//
+// A stream that ends in the middle of a record yields io.ErrUnexpectedEOF,
+// a record length over MaxRecordSize yields ErrRecordTooLarge.
+func NewRecordReader(r io.Reader) LineReader {
+	return &RecordReader{reader: bufio.NewReaderSize(r, bufferCapacity)}
+}
+
+type RecordWriter struct {
+	writer io.Writer
+	header [binary.MaxVarintLen64]byte
+}
+
+func (w *RecordWriter) Write(l string) error {
+	if len(l) > MaxRecordSize {
+		return fmt.Errorf("error while writing record: length %d: %w", len(l), ErrRecordTooLarge)
+	}
+
+	n := binary.PutUvarint(w.header[:], uint64(len(l)))
+	if _, err := w.writer.Write(w.header[:n]); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w.writer, l)
+	return err
+}
+
+// NewRecordWriter wraps w in a LineWriter that writes FormatRecord records.
+func NewRecordWriter(w io.Writer) LineWriter {
+	return &RecordWriter{writer: w}
+}
@@ -0,0 +1,200 @@
+package externalsort
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCRLFReader(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		in       string
+		expected []string
+	}{
+		{
+			name:     "empty",
+			in:       "",
+			expected: nil,
+		},
+		{
+			name:     "crlf",
+			in:       "a\r\nb\r\n\r\nc",
+			expected: []string{"a", "b", "", "c"},
+		},
+		{
+			name:     "mixed",
+			in:       "a\nb\r\nc\r",
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			name:     "inner-cr",
+			in:       "a\rb\r\n",
+			expected: []string{"a\rb"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			lines, err := readAll(NewCRLFReader(strings.NewReader(tc.in)))
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, lines)
+		})
+	}
+}
+
+func TestRecordFormat(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		lines []string
+	}{
+		{
+			name:  "empty-record",
+			lines: []string{""},
+		},
+		{
+			name:  "newlines",
+			lines: []string{"a\nb", "\n", "c\r\n"},
+		},
+		{
+			name:  "binary",
+			lines: []string{"\x00\x01\xff", strings.Repeat("x", 300)},
+		},
+		{
+			name:  "huge",
+			lines: []string{strings.Repeat("?", 65537), "!"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewRecordWriter(&buf)
+			for _, l := range tc.lines {
+				require.NoError(t, w.Write(l))
+			}
+
+			lines, err := readAll(NewRecordReader(iotest.HalfReader(&buf)))
+			require.NoError(t, err)
+			require.Equal(t, tc.lines, lines)
+		})
+	}
+}
+
+func TestRecordReader_truncated(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, NewRecordWriter(&buf).Write("abcdef"))
+
+	r := NewRecordReader(bytes.NewReader(buf.Bytes()[:4]))
+	_, err := r.ReadLine()
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.False(t, errors.Is(err, io.EOF))
+}
+
+func TestRecordReader_corrupt(t *testing.T) {
+	for _, size := range []uint64{math.MaxUint64, 1 << 63, MaxRecordSize + 1} {
+		record := binary.AppendUvarint(nil, size)
+		record = append(record, "abcdef"...)
+
+		_, err := NewRecordReader(bytes.NewReader(record)).ReadLine()
+		require.ErrorIs(t, err, ErrRecordTooLarge, "size %d", size)
+	}
+
+	// A length within the limit is not preallocated, the stream is just truncated.
+	record := binary.AppendUvarint(nil, MaxRecordSize)
+	record = append(record, "abcdef"...)
+	_, err := NewRecordReader(bytes.NewReader(record)).ReadLine()
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestSortWithOptions(t *testing.T) {
+	writeInputs := func(t *testing.T, format Format, inputs [][]string) []string {
+		dir := t.TempDir()
+
+		var files []string
+		for i, lines := range inputs {
+			var buf bytes.Buffer
+			w := format.NewWriter(&buf)
+			for _, l := range lines {
+				require.NoError(t, w.Write(l))
+			}
+
+			name := filepath.Join(dir, "in"+string(rune('0'+i)))
+			require.NoError(t, os.WriteFile(name, buf.Bytes(), 0644))
+			files = append(files, name)
+		}
+		return files
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts Options
+	}{
+		{
+			name: "record",
+			opts: Options{Input: FormatRecord, Output: FormatRecord, Runs: FormatRecord},
+		},
+		{
+			name: "record-runs-unset",
+			opts: Options{Input: FormatRecord, Output: FormatRecord},
+		},
+		{
+			name: "record-runs-unset-gzip",
+			opts: Options{Input: FormatRecord, Output: FormatRecord, Compression: CompressionGzip},
+		},
+		{
+			name: "record-gzip",
+			opts: Options{Input: FormatRecord, Output: FormatRecord, Runs: FormatRecord, Compression: CompressionGzip},
+		},
+		{
+			name: "record-spill",
+			opts: Options{Input: FormatRecord, Output: FormatRecord, Runs: FormatRecord, TempDir: os.TempDir()},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			in := writeInputs(t, tc.opts.Input, [][]string{
+				{"b\nb", "a"},
+				{},
+				{"a\n", "c", ""},
+			})
+
+			var original [][]byte
+			for _, f := range in {
+				data, err := os.ReadFile(f)
+				require.NoError(t, err)
+				original = append(original, data)
+			}
+
+			var out bytes.Buffer
+			require.NoError(t, SortWithOptions(&out, tc.opts, in...))
+
+			lines, err := readAll(tc.opts.Output.NewReader(&out))
+			require.NoError(t, err)
+			require.Equal(t, []string{"", "a", "a\n", "b\nb", "c"}, lines)
+
+			if !tc.opts.inPlace() {
+				for i, f := range in {
+					data, err := os.ReadFile(f)
+					require.NoError(t, err)
+					require.Equal(t, original[i], data, "spilled sort must keep inputs intact")
+				}
+			}
+		})
+	}
+}
+
+func TestSortWithOptions_crlf(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in1.txt")
+	require.NoError(t, os.WriteFile(in, []byte("b\r\na\r\nc"), 0644))
+
+	var out bytes.Buffer
+	opts := Options{Input: FormatCRLF, Runs: FormatText, Output: FormatText, Compression: CompressionGzip}
+	require.NoError(t, SortWithOptions(&out, opts, in))
+	require.Equal(t, "a\nb\nc\n", out.String())
+}
@@ -0,0 +1,77 @@
+//go:build !solution
+
+package externalsort
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// mergeReportInterval is the number of merged lines between two progress reports.
+const mergeReportInterval = 1 << 16
+
+// Progress is a snapshot of a running sort.
+type Progress struct {
+	// BytesRead is the number of bytes read from the input files so far.
+	BytesRead int64
+	// RunsProduced is the number of input files already turned into sorted runs.
+	RunsProduced int
+	// TotalRuns is the number of runs the sort is going to produce.
+	TotalRuns int
+	// MergePass is zero while runs are being generated and 1 once
+	// the (single) merge pass has started.
+	MergePass int
+	// LinesMerged is the number of lines written to the output.
+	LinesMerged int64
+}
+
+// progressReporter serializes progress updates coming from concurrent runs.
+type progressReporter struct {
+	mu    sync.Mutex
+	state Progress
+	fn    func(Progress)
+}
+
+func (p *progressReporter) update(f func(state *Progress)) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f(&p.state)
+	if p.fn != nil {
+		p.fn(p.state)
+	}
+}
+
+func (p *progressReporter) addBytes(n int) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.state.BytesRead += int64(n)
+}
+
+// contextReader stops reading from the underlying reader once ctx is done
+// and accounts every read byte in progress.
+type contextReader struct {
+	ctx      context.Context
+	reader   io.Reader
+	progress *progressReporter
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := r.reader.Read(p)
+	r.progress.addBytes(n)
+	return n, err
+}
@@ -3,17 +3,24 @@
 package externalsort
 
 import (
+	"bufio"
+	"bytes"
 	"container/heap"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"slices"
+	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
+
+	"golang.org/x/sync/errgroup"
 )
 
 const (
-	bufferCapacity = 32
+	bufferCapacity = 64 << 10
 )
 
 type BufferedLineReader struct {
@@ -48,7 +55,7 @@ func (r *BufferedLineReader) ReadLine() (l string, err error) {
 			r.buffer = r.buffer[:size]
 			r.offsetBuffer = 0
 		}
-		idx := slices.Index(r.buffer[r.offsetBuffer:], '\n')
+		idx := bytes.IndexByte(r.buffer[r.offsetBuffer:], '\n')
 		if idx == -1 {
 			ans.Write(r.buffer[r.offsetBuffer:])
 			r.offsetBuffer = len(r.buffer)
@@ -61,6 +68,13 @@ func (r *BufferedLineReader) ReadLine() (l string, err error) {
 }
 
 func (w *BufferedLineWriter) Write(l string) error {
+	if sw, ok := w.writer.(io.StringWriter); ok {
+		if _, err := sw.WriteString(l); err != nil {
+			return err
+		}
+		_, err := sw.WriteString("\n")
+		return err
+	}
 	_, err := w.writer.Write([]byte(l + "\n"))
 	return err
 }
@@ -73,17 +87,29 @@ func NewWriter(w io.Writer) LineWriter {
 	return &BufferedLineWriter{writer: w}
 }
 
-type StringHeap []string
+type heapItem struct {
+	line   string
+	source int
+}
+
+type LineHeap []heapItem
 
-func (h *StringHeap) Len() int           { return len(*h) }
-func (h *StringHeap) Less(i, j int) bool { return (*h)[i] < (*h)[j] }
-func (h *StringHeap) Swap(i, j int)      { (*h)[i], (*h)[j] = (*h)[j], (*h)[i] }
+func (h *LineHeap) Len() int { return len(*h) }
 
-func (h *StringHeap) Push(x any) {
-	*h = append(*h, x.(string))
+func (h *LineHeap) Less(i, j int) bool {
+	if (*h)[i].line != (*h)[j].line {
+		return (*h)[i].line < (*h)[j].line
+	}
+	return (*h)[i].source < (*h)[j].source
 }
 
-func (h *StringHeap) Pop() any {
+func (h *LineHeap) Swap(i, j int) { (*h)[i], (*h)[j] = (*h)[j], (*h)[i] }
+
+func (h *LineHeap) Push(x any) {
+	*h = append(*h, x.(heapItem))
+}
+
+func (h *LineHeap) Pop() any {
 	old := *h
 	n := len(old)
 	x := old[n-1]
@@ -92,11 +118,11 @@ func (h *StringHeap) Pop() any {
 }
 
 func Merge(w LineWriter, readers ...LineReader) error {
-	h := &StringHeap{}
-	heap.Init(h)
+	return mergeContext(context.Background(), w, nil, readers)
+}
 
-	bufferLastString := make([]string, len(readers))
-	bufferInvalidated := make([]bool, len(readers))
+func mergeContext(ctx context.Context, w LineWriter, progress *progressReporter, readers []LineReader) error {
+	h := make(LineHeap, 0, len(readers))
 
 	for idx, reader := range readers {
 		line, err := reader.ReadLine()
@@ -104,53 +130,114 @@ func Merge(w LineWriter, readers ...LineReader) error {
 			return fmt.Errorf("error while reading string: %w", err)
 		}
 		if err == nil {
-			heap.Push(h, line)
-			bufferLastString[idx] = line
-		} else {
-			bufferInvalidated[idx] = true
+			h = append(h, heapItem{line: line, source: idx})
 		}
 	}
+	heap.Init(&h)
 
+	var merged int64
 	for h.Len() > 0 {
-		minLine := heap.Pop(h).(string)
-		if err := w.Write(minLine); err != nil {
+		if merged%mergeReportInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			progress.update(func(state *Progress) { state.LinesMerged = merged })
+		}
+		merged++
+
+		top := &h[0]
+		if err := w.Write(top.line); err != nil {
 			return fmt.Errorf("error while writing string: %w", err)
 		}
 
-		for idx, reader := range readers {
-			if minLine == bufferLastString[idx] && !bufferInvalidated[idx] {
-				line, err := reader.ReadLine()
-				if err != nil && err != io.EOF {
-					return fmt.Errorf("error while reading string: %w", err)
-				}
-				if err == nil {
-					heap.Push(h, line)
-					bufferLastString[idx] = line
-				} else {
-					bufferInvalidated[idx] = true
-				}
-				break
-			}
+		line, err := readers[top.source].ReadLine()
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("error while reading string: %w", err)
+		}
+		if err == nil {
+			top.line = line
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
 		}
 	}
 
+	progress.update(func(state *Progress) { state.LinesMerged = merged })
 	return nil
 }
 
-func SortFile(file *os.File) error {
-	reader := NewReader(file)
+// Options configures SortWithOptions.
+type Options struct {
+	// Input is the format of the input files.
+	Input Format
+	// Output is the format of the merged result.
+	Output Format
+	// Runs is the format of the sorted runs produced from every input file.
+	//
+	// Text runs can not hold records containing '\n', so runs of FormatRecord input
+	// are always in FormatRecord, including when Runs is left unset.
+	Runs Format
+	// Compression is applied to the sorted runs.
+	Compression Compression
+	// TempDir is a directory for sorted runs.
+	//
+	// If TempDir is empty and runs use the same uncompressed format as the input,
+	// runs are written over the input files. Otherwise runs are spilled into
+	// a fresh directory inside TempDir (or os.TempDir()) and removed afterwards.
+	TempDir string
+	// Progress, if set, is called whenever a run is produced and periodically
+	// during the merge. Calls are serialized.
+	Progress func(Progress)
+}
+
+// runs returns the format of the runs, see Runs.
+func (o *Options) runs() Format {
+	if o.Input == FormatRecord {
+		return FormatRecord
+	}
+	return o.Runs
+}
 
+func (o *Options) inPlace() bool {
+	return o.TempDir == "" && o.runs() == o.Input && o.Compression == CompressionNone
+}
+
+func readLines(reader LineReader) ([]string, error) {
 	var lines []string
 	for {
 		line, err := reader.ReadLine()
 		if err == io.EOF {
-			break
+			return lines, nil
 		}
 		if err != nil {
-			return fmt.Errorf("error while reading string: %w", err)
+			return nil, fmt.Errorf("error while reading string: %w", err)
 		}
 		lines = append(lines, line)
 	}
+}
+
+func writeLines(w io.Writer, format Format, lines []string) error {
+	buffered := bufio.NewWriterSize(w, bufferCapacity)
+	writer := format.NewWriter(buffered)
+
+	for _, line := range lines {
+		if err := writer.Write(line); err != nil {
+			return fmt.Errorf("error while writing string: %w", err)
+		}
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("error while flushing file: %w", err)
+	}
+
+	return nil
+}
+
+func SortFile(file *os.File) error {
+	lines, err := readLines(NewReader(file))
+	if err != nil {
+		return err
+	}
 
 	sort.Strings(lines)
 	if _, err := file.Seek(0, io.SeekStart); err != nil {
@@ -161,56 +248,125 @@ func SortFile(file *os.File) error {
 		return fmt.Errorf("error while truncating file: %w", err)
 	}
 
-	writer := NewWriter(file)
+	return writeLines(file, FormatText, lines)
+}
 
-	for _, line := range lines {
-		if err := writer.Write(line); err != nil {
-			return fmt.Errorf("error while writing string: %w", err)
-		}
+// sortRun sorts lines of src and writes them into dst, which may be the same file.
+//
+// Cancellation is only observed while reading, so dst is never left half-written.
+func sortRun(ctx context.Context, src, dst string, opts *Options, progress *progressReporter) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error while opening file %s: %w", src, err)
 	}
 
-	return nil
+	lines, err := readLines(opts.Input.NewReader(&contextReader{ctx: ctx, reader: file, progress: progress}))
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("error while closing file %s: %w", src, closeErr)
+	}
+	if err != nil {
+		return fmt.Errorf("error while sorting file %s: %w", src, err)
+	}
+
+	sort.Strings(lines)
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("error while creating file %s: %w", dst, err)
+	}
+
+	compressed := opts.Compression.newWriter(out)
+	err = writeLines(compressed, opts.runs(), lines)
+	if closeErr := compressed.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("error while compressing file %s: %w", dst, closeErr)
+	}
+	if closeErr := out.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("error while closing file %s: %w", dst, closeErr)
+	}
+	return err
 }
 
 func Sort(w io.Writer, in ...string) error {
-	for _, filename := range in {
-		file, err := os.OpenFile(filename, os.O_RDWR, 0644)
-		if err != nil {
-			return fmt.Errorf("error while opening file %s: %w", filename, err)
-		}
+	return SortContext(context.Background(), w, Options{}, in...)
+}
 
-		if err := SortFile(file); err != nil {
-			if err := file.Close(); err != nil {
-				return fmt.Errorf("error while closing file %s: %w", filename, err)
-			}
-			return fmt.Errorf("error while sorting file %s: %w", filename, err)
+// SortWithOptions is like Sort, but allows choosing formats of the input, the output
+// and the intermediate runs.
+func SortWithOptions(w io.Writer, opts Options, in ...string) error {
+	return SortContext(context.Background(), w, opts, in...)
+}
+
+// SortContext is like SortWithOptions, but stops early with ctx.Err() once ctx is done.
+func SortContext(ctx context.Context, w io.Writer, opts Options, in ...string) (err error) {
+	runs := in
+	if !opts.inPlace() {
+		dir, mkdirErr := os.MkdirTemp(opts.TempDir, "externalsort-")
+		if mkdirErr != nil {
+			return fmt.Errorf("error while creating temp dir: %w", mkdirErr)
 		}
+		defer func() {
+			if removeErr := os.RemoveAll(dir); removeErr != nil {
+				err = errors.Join(err, fmt.Errorf("error while removing temp dir: %w", removeErr))
+			}
+		}()
 
-		if err := file.Close(); err != nil {
-			return fmt.Errorf("error while closing file %s: %w", filename, err)
+		runs = make([]string, len(in))
+		for i := range in {
+			runs[i] = filepath.Join(dir, fmt.Sprintf("run%d", i))
 		}
 	}
 
-	readers := make([]LineReader, 0, len(in))
-	for _, filename := range in {
+	progress := &progressReporter{fn: opts.Progress, state: Progress{TotalRuns: len(runs)}}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(runtime.GOMAXPROCS(0))
+	for i := range in {
+		g.Go(func() error {
+			if err := sortRun(gctx, in[i], runs[i], &opts, progress); err != nil {
+				return err
+			}
+			progress.update(func(state *Progress) { state.RunsProduced++ })
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	readers := make([]LineReader, 0, len(runs))
+	files := make([]*os.File, 0, len(runs))
+	defer func() {
+		for _, file := range files {
+			if closeErr := file.Close(); closeErr != nil {
+				err = errors.Join(err, fmt.Errorf("error while closing file %s: %w", file.Name(), closeErr))
+			}
+		}
+	}()
+
+	for _, filename := range runs {
 		file, err := os.Open(filename)
 		if err != nil {
 			return fmt.Errorf("error while opening file %s: %w", filename, err)
 		}
+		files = append(files, file)
 
-		defer func(file *os.File) {
-			if err := file.Close(); err != nil {
-				panic(err)
-			}
-		}(file)
-
-		reader := NewReader(file)
-		readers = append(readers, reader)
+		decompressed, err := opts.Compression.newReader(file)
+		if err != nil {
+			return fmt.Errorf("error while opening file %s: %w", filename, err)
+		}
+		readers = append(readers, opts.runs().NewReader(decompressed))
 	}
 
-	if err := Merge(NewWriter(w), readers...); err != nil {
+	progress.update(func(state *Progress) { state.MergePass = 1 })
+
+	buffered := bufio.NewWriterSize(w, bufferCapacity)
+	if err := mergeContext(ctx, opts.Output.NewWriter(buffered), progress, readers); err != nil {
 		return fmt.Errorf("error while merging sorted files: %w", err)
 	}
 
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("error while flushing output: %w", err)
+	}
+
 	return nil
 }
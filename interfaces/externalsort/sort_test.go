@@ -3,9 +3,14 @@ package externalsort
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"flag"
 	"fmt"
+	"io"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 
@@ -14,6 +19,8 @@ import (
 	"gitlab.com/slon/shad-go/tools/testtool"
 )
 
+var benchLarge = flag.Bool("externalsort.large", false, "run benchmarks on 1 GB inputs")
+
 func TestMerge(t *testing.T) {
 	for _, tc := range []struct {
 		name string
@@ -103,6 +110,188 @@ func TestSort(t *testing.T) {
 	}
 }
 
+func TestSortContext_cancelled(t *testing.T) {
+	in := copyFiles(t, []string{
+		filepath.Join("testdata", "sort", "7", "in1.txt"),
+		filepath.Join("testdata", "sort", "7", "in2.txt"),
+	}, t.TempDir())
+
+	original, err := os.ReadFile(in[0])
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var buf bytes.Buffer
+	err = SortContext(ctx, &buf, Options{}, in...)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Empty(t, buf.String())
+
+	data, err := os.ReadFile(in[0])
+	require.NoError(t, err)
+	require.Equal(t, original, data, "cancelled sort must not touch inputs")
+}
+
+func TestSortContext_cancelDuringMerge(t *testing.T) {
+	in := copyFiles(t, []string{filepath.Join("testdata", "sort", "7", "in1.txt")}, t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	opts := Options{
+		Progress: func(p Progress) {
+			if p.MergePass > 0 {
+				cancel()
+			}
+		},
+	}
+
+	err := SortContext(ctx, io.Discard, opts, in...)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSortContext_progress(t *testing.T) {
+	testCaseDir := filepath.Join("testdata", "sort", "7")
+	files, err := os.ReadDir(testCaseDir)
+	require.NoError(t, err)
+
+	var src []string
+	var size int64
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), "in") {
+			src = append(src, filepath.Join(testCaseDir, f.Name()))
+
+			info, err := f.Info()
+			require.NoError(t, err)
+			size += info.Size()
+		}
+	}
+	in := copyFiles(t, src, t.TempDir())
+
+	var reports []Progress
+	opts := Options{Progress: func(p Progress) { reports = append(reports, p) }}
+	require.NoError(t, SortContext(context.Background(), io.Discard, opts, in...))
+
+	require.NotEmpty(t, reports)
+	for i := 1; i < len(reports); i++ {
+		require.GreaterOrEqual(t, reports[i].RunsProduced, reports[i-1].RunsProduced)
+		require.GreaterOrEqual(t, reports[i].BytesRead, reports[i-1].BytesRead)
+		require.GreaterOrEqual(t, reports[i].MergePass, reports[i-1].MergePass)
+	}
+
+	last := reports[len(reports)-1]
+	require.Equal(t, len(in), last.RunsProduced)
+	require.Equal(t, len(in), last.TotalRuns)
+	require.Equal(t, size, last.BytesRead)
+	require.Equal(t, 1, last.MergePass)
+	require.Equal(t, int64(17920), last.LinesMerged)
+}
+
+func BenchmarkMerge(b *testing.B) {
+	const linesPerReader = 10000
+
+	for _, k := range []int{2, 16, 128} {
+		b.Run(fmt.Sprintf("k=%d", k), func(b *testing.B) {
+			r := rand.New(rand.NewSource(42))
+			inputs := make([]string, k)
+			for i := range inputs {
+				inputs[i] = string(generateSorted(r, linesPerReader))
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				readers := make([]LineReader, 0, k)
+				for _, in := range inputs {
+					readers = append(readers, newStringReader(in))
+				}
+				if err := Merge(NewWriter(io.Discard), readers...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSort(b *testing.B) {
+	for _, tc := range []struct {
+		name   string
+		size   int64
+		nFiles int
+		large  bool
+	}{
+		{name: "16MB", size: 16 << 20, nFiles: 8},
+		{name: "128MB", size: 128 << 20, nFiles: 16},
+		{name: "1GB", size: 1 << 30, nFiles: 32, large: true},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			if tc.large && !*benchLarge {
+				b.Skip("pass -externalsort.large to run benchmarks on 1 GB inputs")
+			}
+
+			srcDir := b.TempDir()
+			src := generateFiles(b, srcDir, tc.size, tc.nFiles)
+			dstDir := b.TempDir()
+
+			b.SetBytes(tc.size)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				in := copyFiles(b, src, dstDir)
+				b.StartTimer()
+
+				if err := Sort(io.Discard, in...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func generateSorted(r *rand.Rand, n int) []byte {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = randomLine(r)
+	}
+	sort.Strings(lines)
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+func generateFiles(b *testing.B, dir string, size int64, nFiles int) []string {
+	b.Helper()
+
+	r := rand.New(rand.NewSource(42))
+	var files []string
+	for i := 0; i < nFiles; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("in%d.txt", i))
+		f, err := os.Create(name)
+		require.NoError(b, err)
+
+		w := bufio.NewWriter(f)
+		for written := int64(0); written < size/int64(nFiles); {
+			n, err := w.WriteString(randomLine(r) + "\n")
+			require.NoError(b, err)
+			written += int64(n)
+		}
+		require.NoError(b, w.Flush())
+		require.NoError(b, f.Close())
+
+		files = append(files, name)
+	}
+
+	return files
+}
+
+func randomLine(r *rand.Rand) string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+	line := make([]byte, 16+r.Intn(112))
+	for i := range line {
+		line[i] = alphabet[r.Intn(len(alphabet))]
+	}
+	return string(line)
+}
+
 func listDirs(t *testing.T, dir string) []string {
 	t.Helper()
 
@@ -119,7 +308,7 @@ func listDirs(t *testing.T, dir string) []string {
 	return dirs
 }
 
-func copyFiles(t *testing.T, in []string, dir string) []string {
+func copyFiles(t testing.TB, in []string, dir string) []string {
 	t.Helper()
 
 	var ret []string
@@ -130,7 +319,7 @@ func copyFiles(t *testing.T, in []string, dir string) []string {
 	return ret
 }
 
-func copyFile(t *testing.T, f, dir string) string {
+func copyFile(t testing.TB, f, dir string) string {
 	t.Helper()
 
 	data, err := os.ReadFile(f)
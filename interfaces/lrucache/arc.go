@@ -0,0 +1,210 @@
+//go:build !solution
+
+package lrucache
+
+import (
+	"container/list"
+	"sync"
+)
+
+type arcList int
+
+const (
+	// arcT1 holds entries seen once recently.
+	arcT1 arcList = iota
+	// arcT2 holds entries seen at least twice recently.
+	arcT2
+	// arcB1 holds keys recently evicted from T1.
+	arcB1
+	// arcB2 holds keys recently evicted from T2.
+	arcB2
+)
+
+// ARC is an adaptive replacement cache.
+//
+// ARC balances between recency and frequency by keeping two lists of resident
+// entries (seen once and seen at least twice) together with "ghost" lists of
+// recently evicted keys, and adapts the target size of each list on ghost hits.
+// Unlike LRU it is resistant to scans. ARC is safe for concurrent use.
+//
+// See https://www.usenix.org/legacy/events/fast03/tech/full_papers/megiddo/megiddo.pdf.
+type ARC[K comparable, V any] struct {
+	mu    sync.Mutex
+	lists [4]list.List
+	index map[K]*list.Element
+	// p is the target size of T1.
+	p     int
+	cap   int
+	tick  uint64
+	stats Stats
+}
+
+type arcEntry[K comparable, V any] struct {
+	accessed[K, V]
+	where arcList
+}
+
+func (c *ARC[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.index[key]
+	if !ok || elem.Value.(*arcEntry[K, V]).where >= arcB1 {
+		c.stats.Misses++
+		var zero V
+		return zero, false
+	}
+
+	c.stats.Hits++
+	e := elem.Value.(*arcEntry[K, V])
+	c.move(elem, arcT2)
+	return e.value, true
+}
+
+func (c *ARC[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cap <= 0 {
+		return
+	}
+
+	if elem, ok := c.index[key]; ok {
+		e := elem.Value.(*arcEntry[K, V])
+		e.value = value
+
+		switch e.where {
+		case arcT1, arcT2:
+		case arcB1:
+			c.p = min(c.cap, c.p+max(c.lists[arcB2].Len()/c.lists[arcB1].Len(), 1))
+			if c.resident() >= c.cap {
+				c.replace(false)
+			}
+		case arcB2:
+			c.p = max(0, c.p-max(c.lists[arcB1].Len()/c.lists[arcB2].Len(), 1))
+			if c.resident() >= c.cap {
+				c.replace(true)
+			}
+		}
+
+		c.move(elem, arcT2)
+		return
+	}
+
+	if c.resident() >= c.cap {
+		c.replace(false)
+	}
+	if c.lists[arcB1].Len() > c.cap-c.p {
+		c.dropGhost(arcB1)
+	}
+	if c.lists[arcB2].Len() > c.p {
+		c.dropGhost(arcB2)
+	}
+
+	c.tick++
+	e := &arcEntry[K, V]{accessed: accessed[K, V]{key: key, value: value, access: c.tick}, where: arcT1}
+	c.index[key] = c.lists[arcT1].PushFront(e)
+}
+
+func (c *ARC[K, V]) resident() int {
+	return c.lists[arcT1].Len() + c.lists[arcT2].Len()
+}
+
+// move makes elem the most recently used entry of list to.
+func (c *ARC[K, V]) move(elem *list.Element, to arcList) {
+	e := elem.Value.(*arcEntry[K, V])
+	if to < arcB1 {
+		c.tick++
+		e.access = c.tick
+	}
+
+	if e.where == to {
+		c.lists[to].MoveToFront(elem)
+		return
+	}
+
+	c.lists[e.where].Remove(elem)
+	e.where = to
+	c.index[e.key] = c.lists[to].PushFront(e)
+}
+
+// replace evicts a resident entry into the corresponding ghost list.
+func (c *ARC[K, V]) replace(inB2 bool) {
+	t1 := c.lists[arcT1].Len()
+	from, to := arcT2, arcB2
+	if t1 > 0 && (t1 > c.p || (t1 == c.p && inB2)) {
+		from, to = arcT1, arcB1
+	}
+
+	if c.lists[from].Len() == 0 {
+		from, to = arcT1+arcT2-from, arcB1+arcB2-to
+	}
+
+	elem := c.lists[from].Back()
+	if elem == nil {
+		return
+	}
+
+	e := elem.Value.(*arcEntry[K, V])
+	var zero V
+	e.value = zero
+	c.move(elem, to)
+	c.stats.Evictions++
+
+	if c.lists[to].Len() > c.cap {
+		c.dropGhost(to)
+	}
+}
+
+func (c *ARC[K, V]) dropGhost(from arcList) {
+	elem := c.lists[from].Back()
+	if elem == nil {
+		return
+	}
+	delete(c.index, c.lists[from].Remove(elem).(*arcEntry[K, V]).key)
+}
+
+func (c *ARC[K, V]) Range(f func(key K, value V) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make([]*accessed[K, V], 0, c.resident())
+	for _, l := range []arcList{arcT1, arcT2} {
+		for elem := c.lists[l].Front(); elem != nil; elem = elem.Next() {
+			entries = append(entries, &elem.Value.(*arcEntry[K, V]).accessed)
+		}
+	}
+	rangeByAccess(entries, f)
+}
+
+func (c *ARC[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := range c.lists {
+		c.lists[i].Init()
+	}
+	clear(c.index)
+	c.p = 0
+}
+
+// Len returns the number of resident entries in the cache.
+func (c *ARC[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.resident()
+}
+
+// Stats returns hit and eviction counters of the cache.
+func (c *ARC[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+// NewARC returns an empty ARC cache holding at most cap entries.
+func NewARC[K comparable, V any](cap int) *ARC[K, V] {
+	return &ARC[K, V]{index: make(map[K]*list.Element), cap: cap}
+}
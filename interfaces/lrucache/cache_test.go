@@ -4,153 +4,262 @@ import (
 	"math/rand"
 	"runtime/debug"
 	"sort"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 )
 
+// requireAccessOrder checks that keys are some of accessed, in the order of their last access.
+func requireAccessOrder(t *testing.T, accessed, keys []int) {
+	t.Helper()
+
+	last := make(map[int]int)
+	for i, key := range accessed {
+		last[key] = i
+	}
+	for i := 1; i < len(keys); i++ {
+		require.Less(t, last[keys[i-1]], last[keys[i]], "keys: %v", keys)
+	}
+}
+
 func TestCache_empty(t *testing.T) {
-	c := New(0)
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			c := p.new(0)
 
-	c.Set(1, 2)
-	_, ok := c.Get(1)
-	require.False(t, ok)
+			c.Set(1, 2)
+			_, ok := c.Get(1)
+			require.False(t, ok)
+		})
+	}
 }
 
 func TestCache_update(t *testing.T) {
-	c := New(1)
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			c := p.new(1)
 
-	_, ok := c.Get(1)
-	require.False(t, ok)
+			_, ok := c.Get(1)
+			require.False(t, ok)
 
-	c.Set(1, 2)
-	v, ok := c.Get(1)
-	require.True(t, ok)
-	require.Equal(t, 2, v)
+			c.Set(1, 2)
+			v, ok := c.Get(1)
+			require.True(t, ok)
+			require.Equal(t, 2, v)
+
+			c.Set(1, 3)
+			v, ok = c.Get(1)
+			require.True(t, ok)
+			require.Equal(t, 3, v)
+		})
+	}
 }
 
 func TestCache_Get(t *testing.T) {
-	c := New(5)
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			c := p.new(5)
+
+			for i := 0; i < 5; i++ {
+				c.Set(i, i)
+			}
+
+			c.Get(0)
+			c.Get(1)
+
+			c.Set(5, 5)
+			c.Set(6, 6)
 
-	for i := 0; i < 5; i++ {
-		c.Set(i, i)
+			keys, values := rangeKeys(c)
+			require.Equal(t, keys, values)
+			if p.lru {
+				require.Equal(t, []int{4, 0, 1, 5, 6}, keys)
+				return
+			}
+			// Other policies may keep other keys, but never the ones accessed twice.
+			require.Len(t, keys, 5)
+			require.Subset(t, keys, []int{0, 1})
+			requireAccessOrder(t, []int{2, 3, 4, 0, 1, 5, 6}, keys)
+		})
 	}
+}
 
-	c.Get(0)
-	c.Get(1)
+func TestCache_accessOrder(t *testing.T) {
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			c := p.new(10)
+			for i := 0; i < 5; i++ {
+				c.Set(i, i*10)
+			}
 
-	c.Set(5, 5)
-	c.Set(6, 6)
+			for _, k := range []int{3, 0, 4} {
+				_, ok := c.Get(k)
+				require.True(t, ok)
+			}
+			c.Set(1, 11)
 
-	var keys, values []int
-	c.Range(func(key, value int) bool {
-		keys = append(keys, key)
-		values = append(values, value)
-		return true
-	})
-	require.Equal(t, []int{4, 0, 1, 5, 6}, keys)
-	require.Equal(t, []int{4, 0, 1, 5, 6}, values)
+			keys, values := rangeKeys(c)
+			require.Equal(t, []int{2, 3, 0, 4, 1}, keys)
+			require.Equal(t, []int{20, 30, 0, 40, 11}, values)
+		})
+	}
 }
 
 func TestCache_Clear(t *testing.T) {
-	c := New(5)
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			c := p.new(5)
 
-	for i := 0; i < 10; i++ {
-		c.Set(i, i)
-	}
+			for i := 0; i < 10; i++ {
+				c.Set(i, i)
+			}
 
-	c.Clear()
+			c.Clear()
 
-	for i := 9; i >= 0; i-- {
-		c.Set(i, i)
-	}
+			keys, _ := rangeKeys(c)
+			require.Empty(t, keys)
+			for i := 0; i < 10; i++ {
+				_, ok := c.Get(i)
+				require.False(t, ok)
+			}
 
-	var keys, values []int
-	c.Range(func(key, value int) bool {
-		keys = append(keys, key)
-		values = append(values, value)
-		return true
-	})
+			for i := 9; i >= 0; i-- {
+				c.Set(i, i)
+			}
 
-	require.Equal(t, []int{4, 3, 2, 1, 0}, keys)
-	require.Equal(t, []int{4, 3, 2, 1, 0}, values)
+			keys, values := rangeKeys(c)
+			require.Equal(t, keys, values)
+			if p.lru {
+				require.Equal(t, []int{4, 3, 2, 1, 0}, keys)
+				return
+			}
+			require.Len(t, keys, 5)
+			requireAccessOrder(t, []int{9, 8, 7, 6, 5, 4, 3, 2, 1, 0}, keys)
+		})
+	}
 }
 
 func TestCache_Range(t *testing.T) {
-	c := New(5)
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			c := p.new(5)
 
-	for i := 0; i < 10; i++ {
-		c.Set(i, i)
-	}
+			for i := 0; i < 10; i++ {
+				c.Set(i, i)
+			}
 
-	var keys, values []int
-	c.Range(func(key, value int) bool {
-		keys = append(keys, key)
-		values = append(values, value)
-		return key < 8
-	})
+			var keys, values []int
+			c.Range(func(key, value int) bool {
+				keys = append(keys, key)
+				values = append(values, value)
+				return key < 8
+			})
 
-	require.Equal(t, []int{5, 6, 7, 8}, keys)
-	require.Equal(t, []int{5, 6, 7, 8}, values)
+			require.Equal(t, keys, values)
+			if p.lru {
+				require.Equal(t, []int{5, 6, 7, 8}, keys)
+			}
+
+			n := 0
+			c.Range(func(key, value int) bool {
+				n++
+				return n < 2
+			})
+			require.Equal(t, 2, n)
+		})
+	}
 }
 
 func TestCache_eviction(t *testing.T) {
-	r := rand.New(rand.NewSource(42))
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(42))
 
-	for _, tc := range []struct {
-		name       string
-		cap        int
-		numInserts int
-		maxKey     int32
-	}{
-		{
-			name:       "empty",
-			cap:        0,
-			numInserts: 10,
-			maxKey:     10,
-		},
-		{
-			name:       "underused",
-			cap:        100,
-			numInserts: 90,
-			maxKey:     1000,
-		},
-		{
-			name:       "simple",
-			cap:        100,
-			numInserts: 10000,
-			maxKey:     1000,
-		},
-	} {
-		t.Run(tc.name, func(t *testing.T) {
-			c := New(tc.cap)
+			for _, tc := range []struct {
+				name       string
+				cap        int
+				numInserts int
+				maxKey     int32
+			}{
+				{
+					name:       "empty",
+					cap:        0,
+					numInserts: 10,
+					maxKey:     10,
+				},
+				{
+					name:       "underused",
+					cap:        100,
+					numInserts: 90,
+					maxKey:     1000,
+				},
+				{
+					name:       "simple",
+					cap:        100,
+					numInserts: 10000,
+					maxKey:     1000,
+				},
+			} {
+				t.Run(tc.name, func(t *testing.T) {
+					c := p.new(tc.cap)
 
-			keyToValue := make(map[int]int)
-			for i := 0; i < tc.numInserts; i++ {
-				key := int(r.Int31n(tc.maxKey))
-				c.Set(key, i)
-				keyToValue[key] = i
+					keyToValue := make(map[int]int)
+					for i := 0; i < tc.numInserts; i++ {
+						key := int(r.Int31n(tc.maxKey))
+						c.Set(key, i)
+						keyToValue[key] = i
+					}
+
+					var keys, values []int
+					c.Range(func(key, value int) bool {
+						require.Equal(t, keyToValue[key], value)
+						keys = append(keys, key)
+						values = append(values, value)
+						return true
+					})
+
+					expectedLen := tc.cap
+					if len(keyToValue) < tc.cap {
+						expectedLen = len(keyToValue)
+					}
+					require.Len(t, values, expectedLen)
+					require.True(t, sort.IntsAreSorted(values), "values: %+v", values)
+
+					for _, k := range keys {
+						v, ok := c.Get(k)
+						require.True(t, ok)
+						require.Equal(t, keyToValue[k], v)
+					}
+				})
 			}
+		})
+	}
+}
 
-			var keys, values []int
-			c.Range(func(key, value int) bool {
-				require.Equal(t, keyToValue[key], value)
-				keys = append(keys, key)
-				values = append(values, value)
-				return true
-			})
+func TestCache_consistency(t *testing.T) {
+	const capacity = 100
 
-			expectedLen := tc.cap
-			if len(keyToValue) < tc.cap {
-				expectedLen = len(keyToValue)
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(42))
+			c := p.new(capacity)
+
+			latest := map[int]int{}
+			for i := 0; i < 10000; i++ {
+				key := r.Intn(500)
+				if r.Intn(2) == 0 {
+					c.Set(key, i)
+					latest[key] = i
+				} else if v, ok := c.Get(key); ok {
+					require.Equal(t, latest[key], v)
+				}
 			}
-			require.Len(t, values, expectedLen)
-			require.True(t, sort.IntsAreSorted(values), "values: %+v", values)
 
-			for _, k := range keys {
-				v, ok := c.Get(k)
-				require.True(t, ok)
-				require.Equal(t, keyToValue[k], v)
+			keys, values := rangeKeys(c)
+			require.LessOrEqual(t, len(keys), capacity)
+			for i, k := range keys {
+				require.Equal(t, latest[k], values[i])
 			}
 		})
 	}
@@ -189,3 +298,84 @@ func BenchmarkCache_Set(b *testing.B) {
 		})
 	}
 }
+
+func TestLRU_generic(t *testing.T) {
+	c := NewLRU[string, []byte](2)
+
+	c.Set("a", []byte("1"))
+	c.Set("b", []byte("2"))
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	require.Equal(t, []byte("1"), v)
+
+	c.Set("c", []byte("3"))
+	_, ok = c.Get("b")
+	require.False(t, ok)
+	require.Equal(t, 2, c.Len())
+
+	var keys []string
+	c.Range(func(key string, value []byte) bool {
+		keys = append(keys, key)
+		return true
+	})
+	require.Equal(t, []string{"a", "c"}, keys)
+
+	c.Clear()
+	require.Equal(t, 0, c.Len())
+	_, ok = c.Get("a")
+	require.False(t, ok)
+}
+
+func BenchmarkCache_Get(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		cap  int
+	}{
+		{
+			name: "small",
+			cap:  1,
+		},
+		{
+			name: "medium",
+			cap:  1000,
+		},
+		{
+			name: "large",
+			cap:  1000000,
+		},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			c := New(tc.cap)
+			for i := 0; i < tc.cap; i++ {
+				c.Set(i, i)
+			}
+			b.ResetTimer()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				c.Get(i % tc.cap)
+			}
+		})
+	}
+}
+
+func BenchmarkLRU_string(b *testing.B) {
+	for _, cap := range []int{1000, 1000000} {
+		b.Run(strconv.Itoa(cap), func(b *testing.B) {
+			keys := make([]string, 2*cap)
+			for i := range keys {
+				keys[i] = strconv.Itoa(i)
+			}
+
+			c := NewLRU[string, int](cap)
+			b.ResetTimer()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				key := keys[i%len(keys)]
+				if _, ok := c.Get(key); !ok {
+					c.Set(key, i)
+				}
+			}
+		})
+	}
+}
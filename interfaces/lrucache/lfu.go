@@ -0,0 +1,153 @@
+//go:build !solution
+
+package lrucache
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// LFU is a least frequently used cache. Among entries with equal access
+// counts the least recently used one is evicted first.
+//
+// Get and Set take O(log n) time. LFU is safe for concurrent use.
+type LFU[K comparable, V any] struct {
+	mu    sync.Mutex
+	index map[K]*lfuEntry[K, V]
+	heap  lfuHeap[K, V]
+	cap   int
+	tick  uint64
+	stats Stats
+}
+
+type lfuEntry[K comparable, V any] struct {
+	accessed[K, V]
+	freq uint64
+	pos  int
+}
+
+type lfuHeap[K comparable, V any] []*lfuEntry[K, V]
+
+func (h lfuHeap[K, V]) Len() int { return len(h) }
+
+func (h lfuHeap[K, V]) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].access < h[j].access
+}
+
+func (h lfuHeap[K, V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].pos = i
+	h[j].pos = j
+}
+
+func (h *lfuHeap[K, V]) Push(x any) {
+	e := x.(*lfuEntry[K, V])
+	e.pos = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap[K, V]) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	*h = old[0 : n-1]
+	return x
+}
+
+func (c *LFU[K, V]) touch(e *lfuEntry[K, V]) {
+	c.tick++
+	e.freq++
+	e.access = c.tick
+	heap.Fix(&c.heap, e.pos)
+}
+
+func (c *LFU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.index[key]
+	if !ok {
+		c.stats.Misses++
+		var zero V
+		return zero, false
+	}
+
+	c.stats.Hits++
+	c.touch(e)
+	return e.value, true
+}
+
+func (c *LFU[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.index[key]; ok {
+		e.value = value
+		c.touch(e)
+		return
+	}
+
+	if c.cap <= 0 {
+		return
+	}
+
+	if len(c.heap) == c.cap {
+		victim := heap.Pop(&c.heap).(*lfuEntry[K, V])
+		delete(c.index, victim.key)
+		c.stats.Evictions++
+	}
+
+	c.tick++
+	e := &lfuEntry[K, V]{accessed: accessed[K, V]{key: key, value: value, access: c.tick}, freq: 1}
+	heap.Push(&c.heap, e)
+	c.index[key] = e
+}
+
+func (c *LFU[K, V]) Range(f func(key K, value V) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make([]*accessed[K, V], 0, len(c.heap))
+	for _, e := range c.heap {
+		entries = append(entries, &e.accessed)
+	}
+	rangeByAccess(entries, f)
+}
+
+func (c *LFU[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.index)
+	clear(c.heap)
+	c.heap = c.heap[:0]
+}
+
+// Len returns the number of entries in the cache.
+func (c *LFU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.heap)
+}
+
+// Stats returns hit and eviction counters of the cache.
+func (c *LFU[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+// NewLFU returns an empty LFU cache holding at most cap entries.
+func NewLFU[K comparable, V any](cap int) *LFU[K, V] {
+	return &LFU[K, V]{
+		index: make(map[K]*lfuEntry[K, V], max(cap, 0)),
+		heap:  make(lfuHeap[K, V], 0, max(cap, 0)),
+		cap:   cap,
+	}
+}
@@ -0,0 +1,133 @@
+//go:build !solution
+
+package lrucache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Loader loads the value of a key missing from the cache.
+type Loader[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+// LoadingOptions configures a Loading cache.
+type LoadingOptions struct {
+	// NegativeTTL is how long loader errors are cached.
+	// Zero means errors are not cached and every GetOrLoad retries the load.
+	NegativeTTL time.Duration
+	// RefreshAhead enables refreshing entries that expire in less than RefreshAhead.
+	// Such entries are returned as is, while a fresh value is loaded in the background.
+	RefreshAhead time.Duration
+}
+
+// Loading is a cache that loads missing values on demand.
+//
+// Concurrent GetOrLoad calls for the same key share a single loader call,
+// so a popular key that is missing from the cache is loaded only once.
+type Loading[K comparable, V any] struct {
+	cache  *LRU[K, V]
+	errors *LRU[K, error]
+	opts   LoadingOptions
+
+	mu       sync.Mutex
+	inflight map[K]*loadCall[V]
+	loads    sync.WaitGroup
+}
+
+// loadCall is a loader call in progress. done is closed once value and err are set.
+type loadCall[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// GetOrLoad returns the value of key from the cache, calling loader on a miss.
+//
+// If another GetOrLoad is already loading the key, GetOrLoad waits for its result
+// instead. The load is not cancelled when ctx is done, because other callers may
+// be waiting for it, but GetOrLoad returns ctx.Err() immediately.
+func (c *Loading[K, V]) GetOrLoad(ctx context.Context, key K, loader Loader[K, V]) (V, error) {
+	if value, expiresAt, ok := c.cache.get(key); ok {
+		if c.opts.RefreshAhead > 0 && !expiresAt.IsZero() && c.cache.now().Add(c.opts.RefreshAhead).After(expiresAt) {
+			c.load(ctx, key, loader)
+		}
+		return value, nil
+	}
+
+	if err, ok := c.errors.Get(key); ok {
+		var zero V
+		return zero, err
+	}
+
+	call := c.load(ctx, key, loader)
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// load returns the call loading key, starting it if there is none.
+func (c *Loading[K, V]) load(ctx context.Context, key K, loader Loader[K, V]) *loadCall[V] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if call, ok := c.inflight[key]; ok {
+		return call
+	}
+
+	call := &loadCall[V]{done: make(chan struct{})}
+	c.inflight[key] = call
+
+	c.loads.Add(1)
+	go func() {
+		defer c.loads.Done()
+
+		call.value, call.err = loader(context.WithoutCancel(ctx), key)
+
+		if call.err != nil {
+			if c.opts.NegativeTTL > 0 {
+				c.errors.SetWithTTL(key, call.err, c.opts.NegativeTTL)
+			}
+		} else {
+			c.errors.Delete(key)
+			c.cache.Set(key, call.value)
+		}
+
+		c.mu.Lock()
+		delete(c.inflight, key)
+		c.mu.Unlock()
+
+		close(call.done)
+	}()
+
+	return call
+}
+
+// Cache returns the underlying cache.
+func (c *Loading[K, V]) Cache() *LRU[K, V] {
+	return c.cache
+}
+
+// Wait blocks until all loads in progress, including background refreshes, finish.
+func (c *Loading[K, V]) Wait() {
+	c.loads.Wait()
+}
+
+// NewLoading returns a loading cache on top of cache.
+//
+// Values are stored in cache with its default TTL, see Options.TTL.
+func NewLoading[K comparable, V any](cache *LRU[K, V], opts LoadingOptions) *Loading[K, V] {
+	return &Loading[K, V]{
+		cache: cache,
+		errors: NewLRUWithOptions(Options[K, error]{
+			Capacity: max(cache.opts.Capacity, 1),
+			Now:      cache.opts.Now,
+		}),
+		opts:     opts,
+		inflight: make(map[K]*loadCall[V]),
+	}
+}
@@ -0,0 +1,153 @@
+package lrucache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestLoading_dedup(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	const callers = 100
+
+	c := NewLoading(NewLRU[string, string](10), LoadingOptions{})
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context, key string) (string, error) {
+		calls.Add(1)
+		<-release
+		return "value-" + key, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]string, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.GetOrLoad(context.Background(), "k", loader)
+			if err != nil {
+				t.Errorf("GetOrLoad: %v", err)
+			}
+			results[i] = v
+		}()
+	}
+
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	require.Equal(t, int32(1), calls.Load())
+	for _, v := range results {
+		require.Equal(t, "value-k", v)
+	}
+
+	v, ok := c.Cache().Get("k")
+	require.True(t, ok)
+	require.Equal(t, "value-k", v)
+}
+
+func TestLoading_cancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := NewLoading(NewLRU[string, string](10), LoadingOptions{})
+
+	release := make(chan struct{})
+	loader := func(ctx context.Context, key string) (string, error) {
+		<-release
+		require.NoError(t, ctx.Err(), "load must outlive the caller")
+		return "v", nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := c.GetOrLoad(ctx, "k", loader)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(release)
+	c.Wait()
+
+	v, ok := c.Cache().Get("k")
+	require.True(t, ok)
+	require.Equal(t, "v", v)
+}
+
+func TestLoading_negativeTTL(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := newFakeClock()
+	c := NewLoading(
+		NewLRUWithOptions(Options[string, int]{Capacity: 10, Now: clock.Now}),
+		LoadingOptions{NegativeTTL: time.Second},
+	)
+
+	errBackend := errors.New("backend is down")
+	var calls int
+	loader := func(ctx context.Context, key string) (int, error) {
+		calls++
+		if calls == 1 {
+			return 0, errBackend
+		}
+		return strconv.Atoi(key)
+	}
+
+	_, err := c.GetOrLoad(context.Background(), "42", loader)
+	require.ErrorIs(t, err, errBackend)
+
+	_, err = c.GetOrLoad(context.Background(), "42", loader)
+	require.ErrorIs(t, err, errBackend)
+	require.Equal(t, 1, calls)
+
+	clock.Advance(time.Second)
+
+	v, err := c.GetOrLoad(context.Background(), "42", loader)
+	require.NoError(t, err)
+	require.Equal(t, 42, v)
+	require.Equal(t, 2, calls)
+}
+
+func TestLoading_refreshAhead(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clock := newFakeClock()
+	c := NewLoading(
+		NewLRUWithOptions(Options[string, int]{Capacity: 10, TTL: time.Minute, Now: clock.Now}),
+		LoadingOptions{RefreshAhead: 10 * time.Second},
+	)
+
+	var version atomic.Int32
+	loader := func(ctx context.Context, key string) (int, error) {
+		return int(version.Add(1)), nil
+	}
+
+	v, err := c.GetOrLoad(context.Background(), "k", loader)
+	require.NoError(t, err)
+	require.Equal(t, 1, v)
+
+	clock.Advance(45 * time.Second)
+	v, err = c.GetOrLoad(context.Background(), "k", loader)
+	require.NoError(t, err)
+	require.Equal(t, 1, v)
+	c.Wait()
+	require.Equal(t, int32(1), version.Load(), "entry is not close to expiry yet")
+
+	clock.Advance(10 * time.Second)
+	v, err = c.GetOrLoad(context.Background(), "k", loader)
+	require.NoError(t, err)
+	require.Equal(t, 1, v, "stale value is returned while refreshing")
+	c.Wait()
+
+	v, err = c.GetOrLoad(context.Background(), "k", loader)
+	require.NoError(t, err)
+	require.Equal(t, 2, v)
+}
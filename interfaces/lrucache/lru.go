@@ -4,69 +4,406 @@ package lrucache
 
 import (
 	"container/list"
-	"fmt"
+	"sync"
+	"time"
 )
 
-type LRUCache struct {
-	Cache list.List
-	Cap   int
+// EvictReason tells why an entry left the cache.
+type EvictReason int
+
+const (
+	// EvictReasonCapacity means the entry was the least recently used one
+	// and the cache ran out of capacity.
+	EvictReasonCapacity EvictReason = iota
+	// EvictReasonExpired means the entry outlived its TTL.
+	EvictReasonExpired
+	// EvictReasonReplaced means Set stored a new value under the same key.
+	EvictReasonReplaced
+	// EvictReasonDeleted means the entry was removed by Delete.
+	EvictReasonDeleted
+	// EvictReasonCleared means the entry was removed by Clear.
+	EvictReasonCleared
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictReasonCapacity:
+		return "capacity"
+	case EvictReasonExpired:
+		return "expired"
+	case EvictReasonReplaced:
+		return "replaced"
+	case EvictReasonDeleted:
+		return "deleted"
+	case EvictReasonCleared:
+		return "cleared"
+	default:
+		return "unknown"
+	}
 }
 
-type Pair struct {
-	Key   int
-	Value int
+// Options configures a cache created by NewLRUWithOptions.
+type Options[K comparable, V any] struct {
+	// Capacity is the maximum total cost of entries in the cache.
+	Capacity int
+	// Cost returns the cost of an entry. Every entry costs 1 if Cost is nil,
+	// so Capacity is the maximum number of entries.
+	Cost func(key K, value V) int
+	// TTL is the lifetime of entries stored with Set. Zero means entries never expire.
+	TTL time.Duration
+	// OnEvict is called for every entry leaving the cache.
+	//
+	// It is called after the cache lock is released, so it may use the cache.
+	OnEvict func(key K, value V, reason EvictReason)
+	// CleanupInterval enables a background janitor removing expired entries
+	// every CleanupInterval. Without it expired entries are removed lazily, on access.
+	//
+	// Caches with a janitor must be closed with Close.
+	CleanupInterval time.Duration
+	// Now returns current time. Defaults to time.Now.
+	Now func() time.Time
 }
 
-func (cont *LRUCache) Get(key int) (int, bool) {
-	for elem := cont.Cache.Front(); elem != nil; elem = elem.Next() {
-		if elem.Value.(*Pair).Key == key {
-			cont.Cache.MoveToFront(elem)
-			return elem.Value.(*Pair).Value, true
-		}
+// LRU is a least recently used cache with keys of type K and values of type V.
+//
+// All operations take O(1) time: list keeps entries in access order and
+// index maps every key to its list element. LRU is safe for concurrent use.
+type LRU[K comparable, V any] struct {
+	mu    sync.Mutex
+	list  list.List
+	index map[K]*list.Element
+	used  int
+	opts  Options[K, V]
+	stats Stats
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	cost      int
+	expiresAt time.Time
+}
+
+type eviction[K comparable, V any] struct {
+	key    K
+	value  V
+	reason EvictReason
+}
+
+// LRUCache is the int-only cache returned by New.
+type LRUCache = LRU[int, int]
+
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	value, _, ok := c.get(key)
+	return value, ok
+}
+
+// get is like Get, but also returns the expiration time of the entry.
+// Zero expiresAt means the entry never expires.
+func (c *LRU[K, V]) get(key K) (value V, expiresAt time.Time, ok bool) {
+	var evicted []eviction[K, V]
+	defer c.notify(&evicted)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.index[key]
+	if !ok {
+		c.stats.Misses++
+		return value, expiresAt, false
 	}
-	return 0, false
+
+	e := elem.Value.(*entry[K, V])
+	if c.expired(e) {
+		c.stats.Misses++
+		c.remove(elem, EvictReasonExpired, &evicted)
+		return value, expiresAt, false
+	}
+
+	c.stats.Hits++
+	c.list.MoveToFront(elem)
+	return e.value, e.expiresAt, true
 }
 
-func (cont *LRUCache) Set(key, value int) {
-	for elem := cont.Cache.Front(); elem != nil; elem = elem.Next() {
-		if elem.Value.(*Pair).Key == key {
-			elem.Value.(*Pair).Value = value
-			cont.Cache.MoveToFront(elem)
+func (c *LRU[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.opts.TTL)
+}
+
+// SetWithTTL is like Set, but the entry expires after ttl instead of the default TTL.
+// Zero ttl means the entry never expires.
+func (c *LRU[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	var evicted []eviction[K, V]
+	defer c.notify(&evicted)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = c.now().Add(ttl)
+	}
+
+	cost := 1
+	if c.opts.Cost != nil {
+		cost = c.opts.Cost(key, value)
+	}
+
+	if elem, ok := c.index[key]; ok {
+		e := elem.Value.(*entry[K, V])
+		if cost > c.opts.Capacity {
+			c.remove(elem, EvictReasonCapacity, &evicted)
 			return
 		}
+
+		c.record(e.key, e.value, EvictReasonReplaced, &evicted)
+		c.used += cost - e.cost
+		e.value, e.cost, e.expiresAt = value, cost, expiresAt
+		c.list.MoveToFront(elem)
+		c.shrink(&evicted)
+		return
 	}
 
-	if cont.Cap == 0 {
+	if cost > c.opts.Capacity {
 		return
 	}
 
-	if cont.Cap == cont.Cache.Len() {
-		cont.Cache.Back().Value.(*Pair).Key = key
-		cont.Cache.Back().Value.(*Pair).Value = value
-		cont.Cache.MoveToFront(cont.Cache.Back())
+	if c.opts.Cost == nil && c.list.Len() == c.opts.Capacity {
+		// Reuse the least recently used element instead of allocating a new one.
+		elem := c.list.Back()
+		e := elem.Value.(*entry[K, V])
+		delete(c.index, e.key)
+
+		reason := EvictReasonCapacity
+		if c.expired(e) {
+			reason = EvictReasonExpired
+		}
+		c.record(e.key, e.value, reason, &evicted)
+
+		e.key, e.value, e.expiresAt = key, value, expiresAt
+		c.index[key] = elem
+		c.list.MoveToFront(elem)
 		return
 	}
 
-	cont.Cache.PushFront(&Pair{key, value})
+	c.index[key] = c.list.PushFront(&entry[K, V]{key: key, value: value, cost: cost, expiresAt: expiresAt})
+	c.used += cost
+	c.shrink(&evicted)
+}
+
+// Delete removes the key from the cache and reports whether it was present.
+func (c *LRU[K, V]) Delete(key K) bool {
+	var evicted []eviction[K, V]
+	defer c.notify(&evicted)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.index[key]
+	if !ok {
+		return false
+	}
+
+	c.remove(elem, EvictReasonDeleted, &evicted)
+	return true
 }
 
-func (cont *LRUCache) Range(f func(key int, value int) bool) {
-	for elem := cont.Cache.Back(); elem != nil; elem = elem.Prev() {
-		if res := f(elem.Value.(*Pair).Key, elem.Value.(*Pair).Value); !res {
+// Range calls f on every unexpired entry in increasing access time order.
+//
+// The cache is locked during Range, so f must not call methods of the cache.
+func (c *LRU[K, V]) Range(f func(key K, value V) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for elem := c.list.Back(); elem != nil; elem = elem.Prev() {
+		e := elem.Value.(*entry[K, V])
+		if c.expired(e) {
+			continue
+		}
+		if !f(e.key, e.value) {
 			return
 		}
 	}
 }
 
-func (cont *LRUCache) Clear() {
-	for front := cont.Cache.Front(); front != nil; {
-		next := front.Next()
-		cont.Cache.Remove(front)
-		front = next
+func (c *LRU[K, V]) Clear() {
+	var evicted []eviction[K, V]
+	defer c.notify(&evicted)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.opts.OnEvict != nil {
+		for elem := c.list.Back(); elem != nil; elem = elem.Prev() {
+			e := elem.Value.(*entry[K, V])
+			c.record(e.key, e.value, EvictReasonCleared, &evicted)
+		}
 	}
+
+	c.list.Init()
+	clear(c.index)
+	c.used = 0
+}
+
+// Len returns the number of entries in the cache, including expired ones
+// that were not removed yet.
+func (c *LRU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.list.Len()
+}
+
+// Cost returns the total cost of entries in the cache.
+func (c *LRU[K, V]) Cost() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.used
+}
+
+// Stats returns hit and eviction counters of the cache.
+func (c *LRU[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+func (c *LRU[K, V]) contains(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.index[key]
+	return ok
+}
+
+// victim returns the key that would be evicted next to make room for a new entry.
+func (c *LRU[K, V]) victim() (key K, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.list.Len() < c.opts.Capacity || c.list.Len() == 0 {
+		return key, false
+	}
+	return c.list.Back().Value.(*entry[K, V]).key, true
+}
+
+// RemoveExpired removes all expired entries and returns their number.
+func (c *LRU[K, V]) RemoveExpired() int {
+	var evicted []eviction[K, V]
+	defer c.notify(&evicted)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for elem := c.list.Back(); elem != nil; {
+		prev := elem.Prev()
+		if c.expired(elem.Value.(*entry[K, V])) {
+			c.remove(elem, EvictReasonExpired, &evicted)
+			removed++
+		}
+		elem = prev
+	}
+	return removed
+}
+
+// Close stops the background janitor, if any. It is safe to call Close more than once.
+func (c *LRU[K, V]) Close() {
+	c.mu.Lock()
+	stop := c.stop
+	c.stop = nil
+	c.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-c.stopped
+	}
+}
+
+func (c *LRU[K, V]) janitor(stop <-chan struct{}) {
+	defer close(c.stopped)
+
+	ticker := time.NewTicker(c.opts.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.RemoveExpired()
+		}
+	}
+}
+
+func (c *LRU[K, V]) now() time.Time {
+	if c.opts.Now != nil {
+		return c.opts.Now()
+	}
+	return time.Now()
+}
+
+func (c *LRU[K, V]) expired(e *entry[K, V]) bool {
+	return !e.expiresAt.IsZero() && !c.now().Before(e.expiresAt)
+}
+
+// shrink evicts least recently used entries until the cache fits into its capacity.
+func (c *LRU[K, V]) shrink(evicted *[]eviction[K, V]) {
+	for c.used > c.opts.Capacity {
+		c.remove(c.list.Back(), EvictReasonCapacity, evicted)
+	}
+}
+
+func (c *LRU[K, V]) remove(elem *list.Element, reason EvictReason, evicted *[]eviction[K, V]) {
+	e := c.list.Remove(elem).(*entry[K, V])
+	delete(c.index, e.key)
+	c.used -= e.cost
+	c.record(e.key, e.value, reason, evicted)
+}
+
+func (c *LRU[K, V]) record(key K, value V, reason EvictReason, evicted *[]eviction[K, V]) {
+	if reason == EvictReasonCapacity || reason == EvictReasonExpired {
+		c.stats.Evictions++
+	}
+	if c.opts.OnEvict != nil {
+		*evicted = append(*evicted, eviction[K, V]{key: key, value: value, reason: reason})
+	}
+}
+
+// notify runs OnEvict for evictions recorded under the lock.
+func (c *LRU[K, V]) notify(evicted *[]eviction[K, V]) {
+	for _, e := range *evicted {
+		c.opts.OnEvict(e.key, e.value, e.reason)
+	}
+}
+
+// NewLRU returns an empty cache holding at most cap entries.
+func NewLRU[K comparable, V any](cap int) *LRU[K, V] {
+	return NewLRUWithOptions(Options[K, V]{Capacity: cap})
+}
+
+// NewLRUWithOptions returns an empty cache configured by opts.
+func NewLRUWithOptions[K comparable, V any](opts Options[K, V]) *LRU[K, V] {
+	c := &LRU[K, V]{opts: opts}
+	if opts.Cost == nil {
+		c.index = make(map[K]*list.Element, max(opts.Capacity, 0))
+	} else {
+		c.index = make(map[K]*list.Element)
+	}
+
+	if opts.CleanupInterval > 0 {
+		c.stop = make(chan struct{})
+		c.stopped = make(chan struct{})
+		go c.janitor(c.stop)
+	}
+
+	return c
 }
 
-func New(Cap int) Cache {
-	fmt.Printf("%T\n", list.List{})
-	return &LRUCache{Cache: list.List{}, Cap: Cap}
+func New(cap int) Cache {
+	return NewLRU[int, int](cap)
 }
@@ -0,0 +1,191 @@
+package lrucache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+type evictionLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *evictionLog) OnEvict(key string, value int, reason EvictReason) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, key+":"+reason.String())
+}
+
+func (l *evictionLog) Events() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.events...)
+}
+
+func TestLRU_TTL(t *testing.T) {
+	clock := newFakeClock()
+	var log evictionLog
+
+	c := NewLRUWithOptions(Options[string, int]{
+		Capacity: 10,
+		TTL:      time.Minute,
+		OnEvict:  log.OnEvict,
+		Now:      clock.Now,
+	})
+
+	c.Set("default", 1)
+	c.SetWithTTL("short", 2, time.Second)
+	c.SetWithTTL("forever", 3, 0)
+
+	clock.Advance(time.Second)
+	_, ok := c.Get("short")
+	require.False(t, ok)
+
+	v, ok := c.Get("default")
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+
+	clock.Advance(time.Minute)
+
+	var keys []string
+	c.Range(func(key string, value int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	require.Equal(t, []string{"forever"}, keys)
+
+	require.Equal(t, 1, c.RemoveExpired())
+	require.Equal(t, 1, c.Len())
+	require.Equal(t, []string{"short:expired", "default:expired"}, log.Events())
+}
+
+func TestLRU_OnEvict(t *testing.T) {
+	var log evictionLog
+
+	c := NewLRUWithOptions(Options[string, int]{Capacity: 2, OnEvict: log.OnEvict})
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("a", 3)
+	c.Set("c", 4)
+	require.True(t, c.Delete("a"))
+	require.False(t, c.Delete("a"))
+	c.Set("d", 5)
+	c.Clear()
+
+	require.Equal(t, []string{
+		"a:replaced",
+		"b:capacity",
+		"a:deleted",
+		"c:cleared",
+		"d:cleared",
+	}, log.Events())
+}
+
+func TestLRU_OnEvictReentrant(t *testing.T) {
+	var c *LRU[string, int]
+	c = NewLRUWithOptions(Options[string, int]{
+		Capacity: 1,
+		OnEvict: func(key string, value int, reason EvictReason) {
+			if key == "a" {
+				c.Set("evicted-"+key, value)
+			}
+		},
+	})
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	v, ok := c.Get("evicted-a")
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+}
+
+func TestLRU_Cost(t *testing.T) {
+	var log evictionLog
+
+	c := NewLRUWithOptions(Options[string, int]{
+		Capacity: 10,
+		Cost:     func(key string, value int) int { return value },
+		OnEvict:  log.OnEvict,
+	})
+
+	c.Set("a", 4)
+	c.Set("b", 4)
+	require.Equal(t, 8, c.Cost())
+
+	c.Get("a")
+	c.Set("c", 5)
+	require.Equal(t, 9, c.Cost())
+	_, ok := c.Get("b")
+	require.False(t, ok)
+
+	c.Set("huge", 11)
+	_, ok = c.Get("huge")
+	require.False(t, ok)
+	require.Equal(t, 9, c.Cost())
+
+	c.Set("c", 7)
+	require.Equal(t, 7, c.Cost())
+	_, ok = c.Get("a")
+	require.False(t, ok)
+
+	c.Set("c", 11)
+	require.Equal(t, 0, c.Cost())
+	require.Equal(t, 0, c.Len())
+
+	require.Equal(t, []string{
+		"b:capacity",
+		"c:replaced",
+		"a:capacity",
+		"c:capacity",
+	}, log.Events())
+}
+
+func TestLRU_janitor(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var log evictionLog
+	c := NewLRUWithOptions(Options[string, int]{
+		Capacity:        10,
+		TTL:             time.Millisecond,
+		CleanupInterval: time.Millisecond,
+		OnEvict:         log.OnEvict,
+	})
+	defer c.Close()
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	require.Eventually(t, func() bool {
+		return c.Len() == 0
+	}, time.Second, time.Millisecond)
+	require.ElementsMatch(t, []string{"a:expired", "b:expired"}, log.Events())
+
+	c.Close()
+}
@@ -0,0 +1,111 @@
+package lrucache
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// policies are the caches run through the Cache contract tests in cache_test.go.
+var policies = []struct {
+	name string
+	new  func(cap int) StatsCache[int, int]
+	// lru is set if the cache evicts the least recently used entry,
+	// so that the tests can expect the exact set of kept keys.
+	lru bool
+}{
+	{name: "lru", new: func(cap int) StatsCache[int, int] { return New(cap).(*LRU[int, int]) }, lru: true},
+	{name: "sharded", new: func(cap int) StatsCache[int, int] {
+		return NewSharded(1, HashInt, Options[int, int]{Capacity: cap})
+	}, lru: true},
+	{name: "lfu", new: func(cap int) StatsCache[int, int] { return NewLFU[int, int](cap) }},
+	{name: "arc", new: func(cap int) StatsCache[int, int] { return NewARC[int, int](cap) }},
+	{name: "tinylfu", new: func(cap int) StatsCache[int, int] { return NewTinyLFU[int, int](cap, HashInt) }},
+}
+
+func rangeKeys(c GenericCache[int, int]) (keys, values []int) {
+	c.Range(func(key, value int) bool {
+		keys = append(keys, key)
+		values = append(values, value)
+		return true
+	})
+	return
+}
+
+func TestPolicies_stats(t *testing.T) {
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			c := p.new(10)
+			c.Set(1, 1)
+			c.Get(1)
+			c.Get(1)
+			c.Get(2)
+
+			stats := c.Stats()
+			require.Equal(t, uint64(2), stats.Hits)
+			require.Equal(t, uint64(1), stats.Misses)
+			require.InDelta(t, 2.0/3, stats.HitRatio(), 1e-9)
+		})
+	}
+}
+
+// scanTrace interleaves accesses to a small hot set with long scans of keys
+// that are never accessed again.
+func scanTrace(r *rand.Rand, n int) []int {
+	const (
+		hotKeys  = 100
+		scanLen  = 300
+		scanProb = 0.002
+	)
+
+	trace := make([]int, 0, n)
+	next := hotKeys
+	for len(trace) < n {
+		if r.Float64() < scanProb {
+			for i := 0; i < scanLen; i++ {
+				trace = append(trace, next)
+				next++
+			}
+			continue
+		}
+		trace = append(trace, r.Intn(hotKeys))
+	}
+	return trace[:n]
+}
+
+func TestPolicies_scanResistance(t *testing.T) {
+	trace := scanTrace(rand.New(rand.NewSource(42)), 200000)
+
+	ratios := map[string]float64{}
+	for _, p := range policies {
+		stats := ReplayTrace(p.new(200), trace, func(key int) int { return key })
+		require.Equal(t, uint64(len(trace)), stats.Hits+stats.Misses)
+
+		ratios[p.name] = stats.HitRatio()
+		t.Logf("%s: %+v, hit ratio %.3f", p.name, stats, stats.HitRatio())
+	}
+
+	for _, name := range []string{"lfu", "arc", "tinylfu"} {
+		require.Greater(t, ratios[name], ratios["lru"], "%s must beat lru on scans", name)
+	}
+}
+
+func BenchmarkPolicies(b *testing.B) {
+	trace := scanTrace(rand.New(rand.NewSource(42)), 1<<16)
+
+	for _, p := range policies {
+		b.Run(p.name, func(b *testing.B) {
+			c := p.new(200)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key := trace[i%len(trace)]
+				if _, ok := c.Get(key); !ok {
+					c.Set(key, key)
+				}
+			}
+			b.ReportMetric(c.Stats().HitRatio(), "hit-ratio")
+		})
+	}
+}
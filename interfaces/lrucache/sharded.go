@@ -0,0 +1,138 @@
+//go:build !solution
+
+package lrucache
+
+import (
+	"hash/maphash"
+	"time"
+)
+
+var stringSeed = maphash.MakeSeed()
+
+// HashString is a shard hash function for string keys.
+func HashString(key string) uint64 {
+	return maphash.String(stringSeed, key)
+}
+
+// HashInt is a shard hash function for int keys.
+func HashInt(key int) uint64 {
+	// splitmix64 finalizer, spreads sequential keys across shards.
+	x := uint64(key)
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Sharded is a cache that spreads keys across independently locked LRU segments,
+// so that concurrent accesses to different keys rarely contend.
+//
+// Eviction order is maintained per shard: the evicted entry is the least recently
+// used one of its shard, not necessarily of the whole cache.
+type Sharded[K comparable, V any] struct {
+	shards []*LRU[K, V]
+	hash   func(K) uint64
+}
+
+func (c *Sharded[K, V]) shard(key K) *LRU[K, V] {
+	return c.shards[c.hash(key)%uint64(len(c.shards))]
+}
+
+func (c *Sharded[K, V]) Get(key K) (V, bool) {
+	return c.shard(key).Get(key)
+}
+
+func (c *Sharded[K, V]) Set(key K, value V) {
+	c.shard(key).Set(key, value)
+}
+
+// SetWithTTL is like Set, but the entry expires after ttl instead of the default TTL.
+func (c *Sharded[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.shard(key).SetWithTTL(key, value, ttl)
+}
+
+// Delete removes the key from the cache and reports whether it was present.
+func (c *Sharded[K, V]) Delete(key K) bool {
+	return c.shard(key).Delete(key)
+}
+
+// Range calls f on all elements of the cache shard by shard.
+// Within a shard elements are visited in increasing access time order,
+// there is no order between elements of different shards.
+//
+// Every shard is locked while it is being visited, so f must not call methods of the cache.
+func (c *Sharded[K, V]) Range(f func(key K, value V) bool) {
+	for _, s := range c.shards {
+		stopped := false
+		s.Range(func(key K, value V) bool {
+			if !f(key, value) {
+				stopped = true
+			}
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+func (c *Sharded[K, V]) Clear() {
+	for _, s := range c.shards {
+		s.Clear()
+	}
+}
+
+// Len returns the number of entries in all shards.
+func (c *Sharded[K, V]) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		n += s.Len()
+	}
+	return n
+}
+
+// Stats returns the sum of counters of all shards.
+func (c *Sharded[K, V]) Stats() Stats {
+	var stats Stats
+	for _, s := range c.shards {
+		stats = stats.Add(s.Stats())
+	}
+	return stats
+}
+
+// Close stops background janitors of all shards.
+func (c *Sharded[K, V]) Close() {
+	for _, s := range c.shards {
+		s.Close()
+	}
+}
+
+// NewSharded returns a cache of n shards, each configured by opts.
+//
+// opts.Capacity is the capacity of the whole cache, it is split between shards exactly:
+// the first opts.Capacity%n shards get one entry more. If opts.Capacity is less than n,
+// some shards have no capacity and the keys of these shards are never cached.
+// hash is used to pick the shard of a key.
+func NewSharded[K comparable, V any](n int, hash func(K) uint64, opts Options[K, V]) *Sharded[K, V] {
+	n = max(n, 1)
+
+	c := &Sharded[K, V]{shards: make([]*LRU[K, V], n), hash: hash}
+	for i := range c.shards {
+		shardOpts := opts
+		shardOpts.Capacity = opts.Capacity / n
+		if i < opts.Capacity%n {
+			shardOpts.Capacity++
+		}
+		c.shards[i] = NewLRUWithOptions(shardOpts)
+	}
+	return c
+}
+
+// NewShardedCache returns an int-only Cache of n shards holding at most cap entries in total.
+func NewShardedCache(n, cap int) Cache {
+	return NewSharded(n, HashInt, Options[int, int]{Capacity: cap})
+}
+
+var _ GenericCache[string, int] = (*Sharded[string, int])(nil)
@@ -0,0 +1,135 @@
+package lrucache
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharded(t *testing.T) {
+	c := NewSharded(4, HashString, Options[string, int]{Capacity: 100})
+
+	for i := 0; i < 50; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	require.Equal(t, 50, c.Len())
+
+	for i := 0; i < 50; i++ {
+		v, ok := c.Get(strconv.Itoa(i))
+		require.True(t, ok)
+		require.Equal(t, i, v)
+	}
+
+	seen := map[string]int{}
+	c.Range(func(key string, value int) bool {
+		seen[key] = value
+		return true
+	})
+	require.Len(t, seen, 50)
+
+	visited := 0
+	c.Range(func(key string, value int) bool {
+		visited++
+		return visited < 10
+	})
+	require.Equal(t, 10, visited)
+
+	require.True(t, c.Delete("0"))
+	_, ok := c.Get("0")
+	require.False(t, ok)
+
+	c.Clear()
+	require.Equal(t, 0, c.Len())
+}
+
+func TestSharded_capacity(t *testing.T) {
+	c := NewShardedCache(8, 64)
+	for i := 0; i < 10000; i++ {
+		c.Set(i, i)
+	}
+
+	n := 0
+	c.Range(func(key, value int) bool {
+		n++
+		return true
+	})
+	require.LessOrEqual(t, n, 64)
+	require.Greater(t, n, 0)
+}
+
+func TestSharded_smallCapacity(t *testing.T) {
+	for _, cap := range []int{0, 1, 5, 15, 17} {
+		c := NewSharded(16, HashInt, Options[int, int]{Capacity: cap})
+		for i := 0; i < 1000; i++ {
+			c.Set(i, i)
+		}
+		require.LessOrEqual(t, c.Len(), cap, "capacity %d", cap)
+		if cap >= 16 {
+			require.Greater(t, c.Len(), 15, "capacity %d", cap)
+		}
+	}
+}
+
+func TestSharded_parallel(t *testing.T) {
+	const (
+		goroutines = 16
+		ops        = 10000
+	)
+
+	c := NewSharded(8, HashInt, Options[int, int]{Capacity: 512})
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < ops; i++ {
+				key := (g*ops + i) % 1024
+				c.Set(key, key)
+				if v, ok := c.Get(key); ok && v != key {
+					t.Errorf("Get(%d) = %d", key, v)
+				}
+				if i%1000 == 0 {
+					c.Range(func(key, value int) bool { return true })
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.LessOrEqual(t, c.Len(), 512)
+}
+
+func BenchmarkCache_parallel(b *testing.B) {
+	const keys = 1 << 16
+
+	for _, tc := range []struct {
+		name  string
+		cache GenericCache[int, int]
+	}{
+		{name: "lru", cache: NewLRU[int, int](keys / 2)},
+		{name: "sharded-16", cache: NewSharded(16, HashInt, Options[int, int]{Capacity: keys / 2})},
+		{name: "sharded-64", cache: NewSharded(64, HashInt, Options[int, int]{Capacity: keys / 2})},
+	} {
+		for _, writes := range []int{10, 50} {
+			b.Run(fmt.Sprintf("%s/writes=%d%%", tc.name, writes), func(b *testing.B) {
+				b.ReportAllocs()
+				b.RunParallel(func(pb *testing.PB) {
+					i := 0
+					for pb.Next() {
+						key := int(HashInt(i) % keys)
+						if i%100 < writes {
+							tc.cache.Set(key, i)
+						} else {
+							tc.cache.Get(key)
+						}
+						i++
+					}
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,85 @@
+//go:build !solution
+
+package lrucache
+
+import "sort"
+
+// Stats holds counters useful for comparing eviction policies.
+type Stats struct {
+	// Hits is the number of Get calls that found the key.
+	Hits uint64
+	// Misses is the number of Get calls that did not find the key.
+	Misses uint64
+	// Evictions is the number of entries removed to make room for others or because they expired.
+	Evictions uint64
+}
+
+// HitRatio returns the fraction of Get calls that found the key.
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// Add returns the sum of two counters.
+func (s Stats) Add(other Stats) Stats {
+	return Stats{
+		Hits:      s.Hits + other.Hits,
+		Misses:    s.Misses + other.Misses,
+		Evictions: s.Evictions + other.Evictions,
+	}
+}
+
+// StatsCache is a cache reporting its Stats.
+type StatsCache[K comparable, V any] interface {
+	GenericCache[K, V]
+	Stats() Stats
+}
+
+// accessed is an entry of a policy that does not keep entries in access order
+// by itself. It remembers the logical time of the last access, so that
+// Range can still visit entries in increasing access time order.
+type accessed[K comparable, V any] struct {
+	key    K
+	value  V
+	access uint64
+}
+
+func rangeByAccess[K comparable, V any](entries []*accessed[K, V], f func(key K, value V) bool) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].access < entries[j].access
+	})
+
+	for _, e := range entries {
+		if !f(e.key, e.value) {
+			return
+		}
+	}
+}
+
+var (
+	_ StatsCache[int, int] = (*LRU[int, int])(nil)
+	_ StatsCache[int, int] = (*Sharded[int, int])(nil)
+	_ StatsCache[int, int] = (*LFU[int, int])(nil)
+	_ StatsCache[int, int] = (*ARC[int, int])(nil)
+	_ StatsCache[int, int] = (*TinyLFU[int, int])(nil)
+)
+
+// ReplayTrace replays a recorded sequence of accessed keys against c: every key is looked up
+// and, on a miss, loaded with load and stored. It returns the change in c's Stats.
+func ReplayTrace[K comparable, V any](c StatsCache[K, V], trace []K, load func(key K) V) Stats {
+	before := c.Stats()
+	for _, key := range trace {
+		if _, ok := c.Get(key); !ok {
+			c.Set(key, load(key))
+		}
+	}
+
+	after := c.Stats()
+	return Stats{
+		Hits:      after.Hits - before.Hits,
+		Misses:    after.Misses - before.Misses,
+		Evictions: after.Evictions - before.Evictions,
+	}
+}
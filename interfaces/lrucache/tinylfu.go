@@ -0,0 +1,153 @@
+//go:build !solution
+
+package lrucache
+
+import (
+	"math/bits"
+	"sync"
+)
+
+const (
+	sketchDepth = 4
+	// sketchMaxCount saturates counters, so that one hot key can not dominate forever.
+	sketchMaxCount = 15
+)
+
+// countMinSketch approximately counts key frequencies in a fixed amount of memory.
+//
+// All counters are halved once the number of increments reaches the sample size,
+// so that the sketch follows changes in the workload.
+type countMinSketch struct {
+	rows    [sketchDepth][]uint8
+	mask    uint64
+	samples int
+	sample  int
+}
+
+func newCountMinSketch(cap int) *countMinSketch {
+	width := uint64(1) << bits.Len64(uint64(max(cap, 8)*2-1))
+
+	s := &countMinSketch{mask: width - 1, sample: 10 * max(cap, 1)}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) slot(h uint64, row int) uint64 {
+	return HashInt(int(h+uint64(row)*0x9e3779b97f4a7c15)) & s.mask
+}
+
+func (s *countMinSketch) increment(h uint64) {
+	for i := range s.rows {
+		if c := &s.rows[i][s.slot(h, i)]; *c < sketchMaxCount {
+			*c++
+		}
+	}
+
+	s.samples++
+	if s.samples == s.sample {
+		s.samples = 0
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] /= 2
+			}
+		}
+	}
+}
+
+func (s *countMinSketch) estimate(h uint64) uint8 {
+	est := uint8(sketchMaxCount)
+	for i := range s.rows {
+		est = min(est, s.rows[i][s.slot(h, i)])
+	}
+	return est
+}
+
+func (s *countMinSketch) reset() {
+	s.samples = 0
+	for i := range s.rows {
+		clear(s.rows[i])
+	}
+}
+
+// TinyLFU is an LRU cache guarded by a TinyLFU admission filter.
+//
+// Every access is recorded in a compact frequency sketch. When the cache is full,
+// a new key is admitted only if it was accessed more often than the LRU victim
+// it would replace, so one-off keys of a scan do not flush the hot set.
+//
+// See https://arxiv.org/abs/1512.00727. TinyLFU is safe for concurrent use.
+type TinyLFU[K comparable, V any] struct {
+	mu     sync.Mutex
+	lru    *LRU[K, V]
+	sketch *countMinSketch
+	hash   func(K) uint64
+	// rejected counts keys that were not admitted.
+	rejected uint64
+}
+
+func (c *TinyLFU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	c.sketch.increment(c.hash(key))
+	c.mu.Unlock()
+
+	return c.lru.Get(key)
+}
+
+func (c *TinyLFU[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h := c.hash(key)
+	c.sketch.increment(h)
+
+	if !c.lru.contains(key) {
+		if victim, ok := c.lru.victim(); ok && c.sketch.estimate(h) <= c.sketch.estimate(c.hash(victim)) {
+			c.rejected++
+			return
+		}
+	}
+
+	c.lru.Set(key, value)
+}
+
+func (c *TinyLFU[K, V]) Range(f func(key K, value V) bool) {
+	c.lru.Range(f)
+}
+
+func (c *TinyLFU[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Clear()
+	c.sketch.reset()
+}
+
+// Len returns the number of entries in the cache.
+func (c *TinyLFU[K, V]) Len() int {
+	return c.lru.Len()
+}
+
+// Stats returns hit and eviction counters of the cache.
+func (c *TinyLFU[K, V]) Stats() Stats {
+	return c.lru.Stats()
+}
+
+// Rejected returns the number of Set calls for new keys that were not admitted.
+func (c *TinyLFU[K, V]) Rejected() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.rejected
+}
+
+// NewTinyLFU returns an empty cache holding at most cap entries.
+// hash is used by the frequency sketch, see HashInt and HashString.
+func NewTinyLFU[K comparable, V any](cap int, hash func(K) uint64) *TinyLFU[K, V] {
+	return &TinyLFU[K, V]{
+		lru:    NewLRU[K, V](cap),
+		sketch: newCountMinSketch(cap),
+		hash:   hash,
+	}
+}
@@ -0,0 +1,296 @@
+//go:build !solution
+
+// Package aeadstream implements authenticated stream encryption.
+//
+// Unlike otp, which only xors data with a keystream, aeadstream detects any
+// modification, reordering or truncation of the ciphertext.
+//
+// The plaintext is split into segments of equal size, the last one may be shorter
+// (or even empty). Every segment is sealed with AES-GCM under a nonce made of a random
+// per-stream prefix, the segment sequence number and a flag marking the last segment:
+//
+//	header  = magic (4) | version (1) | segment size (4) | nonce prefix (7)
+//	segment = AES-GCM(plaintext segment, nonce = prefix | seq (4) | last (1), ad = header)
+package aeadstream
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// DefaultSegmentSize is the plaintext size of a segment used by NewWriter.
+	DefaultSegmentSize = 64 << 10
+	// MaxSegmentSize bounds the memory a Reader allocates for a segment.
+	MaxSegmentSize = 16 << 20
+
+	version     = 1
+	prefixSize  = 7
+	headerSize  = len(magic) + 1 + 4 + prefixSize
+	nonceSize   = prefixSize + 4 + 1
+	overhead    = 16
+	maxSegments = math.MaxUint32
+)
+
+var magic = [4]byte{'O', 'T', 'P', 'S'}
+
+var (
+	// ErrInvalidHeader is returned when the stream does not start with a valid header.
+	ErrInvalidHeader = errors.New("aeadstream: invalid header")
+	// ErrTampered is returned when a segment fails authentication.
+	ErrTampered = errors.New("aeadstream: message authentication failed")
+	// ErrTruncated is returned when the stream ends before its last segment.
+	ErrTruncated = errors.New("aeadstream: stream is truncated")
+	// ErrTooLong is returned when the stream exceeds the maximum number of segments.
+	ErrTooLong = errors.New("aeadstream: stream is too long")
+	// ErrClosed is returned by Write after Close.
+	ErrClosed = errors.New("aeadstream: write to closed stream")
+)
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("aeadstream: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+type segmentNonce [nonceSize]byte
+
+func (n *segmentNonce) set(seq uint32, last bool) []byte {
+	binary.BigEndian.PutUint32(n[prefixSize:], seq)
+	n[nonceSize-1] = 0
+	if last {
+		n[nonceSize-1] = 1
+	}
+	return n[:]
+}
+
+// Writer encrypts data written to it and writes the sealed stream into the underlying writer.
+type Writer struct {
+	writer  io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	nonce   segmentNonce
+	seq     uint32
+	segment []byte
+	sealed  []byte
+	err     error
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// A full segment is sealed only once more data arrives,
+		// as Close has to seal the last segment with the last flag set.
+		if len(w.segment) == cap(w.segment) {
+			if err := w.seal(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := min(cap(w.segment)-len(w.segment), len(p))
+		w.segment = append(w.segment, p[:n]...)
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close seals the last segment. It does not close the underlying writer.
+//
+// Streams that were not closed are rejected by the Reader as truncated.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		if w.err == ErrClosed {
+			return nil
+		}
+		return w.err
+	}
+
+	if err := w.seal(true); err != nil {
+		return err
+	}
+	w.err = ErrClosed
+	return nil
+}
+
+func (w *Writer) seal(last bool) error {
+	if w.seq == maxSegments {
+		w.err = ErrTooLong
+		return w.err
+	}
+
+	w.sealed = w.aead.Seal(w.sealed[:0], w.nonce.set(w.seq, last), w.segment, w.header)
+	w.seq++
+	w.segment = w.segment[:0]
+
+	if _, err := w.writer.Write(w.sealed); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+// NewWriter returns a writer encrypting data with AES-GCM under key,
+// which must be 16, 24 or 32 bytes long.
+//
+// The caller must Close the writer to finish the stream.
+func NewWriter(w io.Writer, key []byte) (*Writer, error) {
+	return NewWriterSize(w, key, DefaultSegmentSize)
+}
+
+// NewWriterSize is like NewWriter, but splits plaintext into segments of the given size.
+func NewWriterSize(w io.Writer, key []byte, segmentSize int) (*Writer, error) {
+	if segmentSize <= 0 || segmentSize > MaxSegmentSize {
+		return nil, fmt.Errorf("aeadstream: invalid segment size %d", segmentSize)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sw := &Writer{
+		writer:  w,
+		aead:    aead,
+		segment: make([]byte, 0, segmentSize),
+		sealed:  make([]byte, 0, segmentSize+overhead),
+	}
+
+	if _, err := rand.Read(sw.nonce[:prefixSize]); err != nil {
+		return nil, fmt.Errorf("aeadstream: generating nonce: %w", err)
+	}
+
+	sw.header = make([]byte, 0, headerSize)
+	sw.header = append(sw.header, magic[:]...)
+	sw.header = append(sw.header, version)
+	sw.header = binary.BigEndian.AppendUint32(sw.header, uint32(segmentSize))
+	sw.header = append(sw.header, sw.nonce[:prefixSize]...)
+
+	if _, err := w.Write(sw.header); err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+// Reader decrypts and authenticates a stream produced by Writer.
+type Reader struct {
+	reader  *bufio.Reader
+	aead    cipher.AEAD
+	header  []byte
+	nonce   segmentNonce
+	seq     uint32
+	sealed  []byte
+	segment []byte
+	offset  int
+	last    bool
+	err     error
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	for r.offset == len(r.segment) {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.last {
+			return 0, io.EOF
+		}
+		r.err = r.open()
+	}
+
+	n := copy(p, r.segment[r.offset:])
+	r.offset += n
+	return n, nil
+}
+
+// open reads, authenticates and decrypts the next segment.
+func (r *Reader) open() error {
+	r.segment, r.offset = r.segment[:0], 0
+
+	n, err := io.ReadFull(r.reader, r.sealed[:cap(r.sealed)])
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		r.last = true
+	case err != nil:
+		return err
+	default:
+		if _, err := r.reader.Peek(1); errors.Is(err, io.EOF) {
+			r.last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if n < overhead {
+		return ErrTruncated
+	}
+	if r.seq == maxSegments {
+		return ErrTooLong
+	}
+
+	r.segment, err = r.aead.Open(r.segment[:0], r.nonce.set(r.seq, r.last), r.sealed[:n], r.header)
+	if err != nil {
+		// A segment that does not verify as the last one may be a regular segment
+		// whose successors were cut off.
+		if r.last {
+			if _, err := r.aead.Open(nil, r.nonce.set(r.seq, false), r.sealed[:n], r.header); err == nil {
+				return ErrTruncated
+			}
+		}
+		return ErrTampered
+	}
+
+	r.seq++
+	return nil
+}
+
+// NewReader returns a reader decrypting the stream read from r with key.
+//
+// Read fails with ErrTampered if the stream was modified, and with ErrTruncated if it
+// ends prematurely. Data returned before the error is authentic, but the caller
+// must not treat it as the complete message.
+func NewReader(r io.Reader, key []byte) (*Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrInvalidHeader
+		}
+		return nil, err
+	}
+
+	if !bytes.Equal(header[:len(magic)], magic[:]) || header[len(magic)] != version {
+		return nil, ErrInvalidHeader
+	}
+
+	segmentSize := binary.BigEndian.Uint32(header[len(magic)+1:])
+	if segmentSize == 0 || segmentSize > MaxSegmentSize {
+		return nil, ErrInvalidHeader
+	}
+
+	sr := &Reader{
+		reader: bufio.NewReaderSize(r, 1),
+		aead:   aead,
+		header: header,
+		sealed: make([]byte, 0, int(segmentSize)+overhead),
+	}
+	copy(sr.nonce[:], header[headerSize-prefixSize:])
+	return sr, nil
+}
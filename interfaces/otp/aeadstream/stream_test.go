@@ -0,0 +1,173 @@
+package aeadstream
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testSegmentSize = 64
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func encrypt(t *testing.T, plaintext []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := NewWriterSize(&buf, testKey, testSegmentSize)
+	require.NoError(t, err)
+
+	_, err = w.Write(plaintext)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func decrypt(ciphertext []byte, key []byte) ([]byte, error) {
+	r, err := NewReader(iotest.HalfReader(bytes.NewReader(ciphertext)), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+	return b
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, testSegmentSize - 1, testSegmentSize, testSegmentSize + 1, 10 * testSegmentSize, 1234} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			plaintext := randomBytes(t, size)
+			ciphertext := encrypt(t, plaintext)
+
+			segments := max(1, (size+testSegmentSize-1)/testSegmentSize)
+			require.Len(t, ciphertext, headerSize+size+segments*overhead)
+
+			decrypted, err := decrypt(ciphertext, testKey)
+			require.NoError(t, err)
+			require.Equal(t, plaintext, decrypted)
+			require.Len(t, decrypted, size)
+		})
+	}
+}
+
+func TestWriter_smallWrites(t *testing.T) {
+	plaintext := randomBytes(t, 1000)
+
+	var buf bytes.Buffer
+	w, err := NewWriterSize(&buf, testKey, testSegmentSize)
+	require.NoError(t, err)
+
+	for i := 0; i < len(plaintext); i += 7 {
+		n, err := w.Write(plaintext[i:min(i+7, len(plaintext))])
+		require.NoError(t, err)
+		require.Equal(t, min(7, len(plaintext)-i), n)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, w.Close())
+
+	_, err = w.Write([]byte("late"))
+	require.ErrorIs(t, err, ErrClosed)
+
+	decrypted, err := decrypt(buf.Bytes(), testKey)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, decrypted)
+}
+
+func TestReader_tampered(t *testing.T) {
+	plaintext := randomBytes(t, 5*testSegmentSize)
+	ciphertext := encrypt(t, plaintext)
+
+	for _, pos := range []int{headerSize - 1, headerSize, headerSize + testSegmentSize + overhead + 3, len(ciphertext) - 1} {
+		t.Run(fmt.Sprint(pos), func(t *testing.T) {
+			modified := bytes.Clone(ciphertext)
+			modified[pos] ^= 1
+
+			_, err := decrypt(modified, testKey)
+			require.ErrorIs(t, err, ErrTampered)
+		})
+	}
+}
+
+func TestReader_reordered(t *testing.T) {
+	plaintext := randomBytes(t, 3*testSegmentSize)
+	ciphertext := encrypt(t, plaintext)
+
+	seg := testSegmentSize + overhead
+	first := ciphertext[headerSize : headerSize+seg]
+	second := ciphertext[headerSize+seg : headerSize+2*seg]
+
+	var modified []byte
+	modified = append(modified, ciphertext[:headerSize]...)
+	modified = append(modified, second...)
+	modified = append(modified, first...)
+	modified = append(modified, ciphertext[headerSize+2*seg:]...)
+
+	_, err := decrypt(modified, testKey)
+	require.ErrorIs(t, err, ErrTampered)
+}
+
+func TestReader_truncated(t *testing.T) {
+	plaintext := randomBytes(t, 3*testSegmentSize+10)
+	ciphertext := encrypt(t, plaintext)
+
+	seg := testSegmentSize + overhead
+	for _, size := range []int{headerSize, headerSize + 5, headerSize + seg, headerSize + 3*seg} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			decrypted, err := decrypt(ciphertext[:size], testKey)
+			require.ErrorIs(t, err, ErrTruncated)
+			require.Equal(t, plaintext[:len(decrypted)], decrypted)
+		})
+	}
+}
+
+func TestReader_unclosed(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriterSize(&buf, testKey, testSegmentSize)
+	require.NoError(t, err)
+
+	_, err = w.Write(randomBytes(t, 3*testSegmentSize))
+	require.NoError(t, err)
+
+	_, err = decrypt(buf.Bytes(), testKey)
+	require.ErrorIs(t, err, ErrTruncated)
+}
+
+func TestReader_wrongKey(t *testing.T) {
+	ciphertext := encrypt(t, []byte("attack at dawn"))
+
+	otherKey := bytes.Clone(testKey)
+	otherKey[0] ^= 1
+
+	_, err := decrypt(ciphertext, otherKey)
+	require.ErrorIs(t, err, ErrTampered)
+}
+
+func TestReader_invalidHeader(t *testing.T) {
+	ciphertext := encrypt(t, []byte("attack at dawn"))
+
+	_, err := NewReader(bytes.NewReader(ciphertext[:headerSize-1]), testKey)
+	require.ErrorIs(t, err, ErrInvalidHeader)
+
+	modified := bytes.Clone(ciphertext)
+	modified[0] = 'X'
+	_, err = NewReader(bytes.NewReader(modified), testKey)
+	require.ErrorIs(t, err, ErrInvalidHeader)
+}
+
+func TestNewWriter_invalidKey(t *testing.T) {
+	_, err := NewWriter(io.Discard, []byte("short"))
+	require.Error(t, err)
+}
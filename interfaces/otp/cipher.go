@@ -3,90 +3,213 @@
 package otp
 
 import (
+	"crypto/subtle"
+	"fmt"
 	"io"
 )
 
-const (
-	bufferCapacity int = 32
-)
+// DefaultBufferSize is the size of the keystream buffer used by NewReader and NewWriter.
+const DefaultBufferSize = 32 << 10
 
-type BufferedReader struct {
-	reader          io.Reader
-	encryptor       io.Reader
-	bufferReader    []byte
-	bufferEncryptor []byte
-	offsetReader    int
-	offsetEncryptor int
+// keystream buffers bytes read from prng.
+type keystream struct {
+	prng   io.Reader
+	buffer []byte
+	offset int
+	err    error
 }
 
-func (r *BufferedReader) Read(arr []byte) (int, error) {
-	if len(r.bufferEncryptor) == r.offsetEncryptor {
-		_, _ = r.encryptor.Read(r.bufferEncryptor)
-		r.offsetEncryptor = 0
-	}
-	if len(r.bufferReader) == r.offsetReader {
-		r.bufferReader = r.bufferReader[:cap(r.bufferReader)]
-		size, err := r.reader.Read(r.bufferReader)
-		if err != nil && err != io.EOF {
-			return 0, err
+// next returns at most n unused keystream bytes, reading prng if the buffer is empty.
+// The returned bytes are consumed only by skip.
+//
+// prng is never read further than requested, as it may be a one-time pad
+// whose bytes must not be wasted.
+func (k *keystream) next(n int) ([]byte, error) {
+	if k.offset == len(k.buffer) {
+		if k.err != nil {
+			return nil, k.err
 		}
-		if size == 0 && err == io.EOF {
-			return 0, io.EOF
+
+		size, err := io.ReadFull(k.prng, k.buffer[:min(n, cap(k.buffer))])
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("otp: prng exhausted: %w", io.ErrUnexpectedEOF)
+		}
+		k.buffer, k.offset, k.err = k.buffer[:size], 0, err
+		if size == 0 {
+			return nil, k.err
 		}
-		r.bufferReader = r.bufferReader[:size]
-		r.offsetReader = 0
+	}
+	return k.buffer[k.offset:min(len(k.buffer), k.offset+n)], nil
+}
+
+func (k *keystream) skip(n int) {
+	k.offset += n
+}
+
+// checkExhausted returns the keystream error err, or io.EOF if r has no data left
+// to be xored with the missing keystream.
+func checkExhausted(r io.Reader, err error) error {
+	var probe [1]byte
+	if _, rerr := io.ReadFull(r, probe[:]); rerr == io.EOF {
+		return io.EOF
+	}
+	return err
+}
+
+func newKeystream(prng io.Reader, size int) keystream {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	buffer := make([]byte, size)
+	return keystream{prng: prng, buffer: buffer, offset: size}
+}
+
+// BufferedReader decrypts data read from the underlying reader.
+type BufferedReader struct {
+	reader io.Reader
+	key    keystream
+	buffer []byte
+}
+
+func (r *BufferedReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	key, err := r.key.next(len(p))
+	if err != nil {
+		return 0, checkExhausted(r.reader, err)
 	}
 
-	toRead := min(len(r.bufferReader)-r.offsetReader, len(r.bufferEncryptor)-r.offsetEncryptor, len(arr))
-	copy(arr, r.bufferReader[r.offsetReader:r.offsetReader+toRead])
+	n, err := r.reader.Read(p[:len(key)])
+	subtle.XORBytes(p, p[:n], key)
+	r.key.skip(n)
+	return n, err
+}
 
-	for i := 0; i < toRead; i++ {
-		arr[i] ^= r.bufferEncryptor[r.offsetEncryptor+i]
+// WriteTo implements io.WriterTo, so that io.Copy decrypts without an intermediate buffer.
+func (r *BufferedReader) WriteTo(w io.Writer) (int64, error) {
+	if r.buffer == nil {
+		r.buffer = make([]byte, cap(r.key.buffer))
 	}
 
-	r.offsetReader += toRead
-	r.offsetEncryptor += toRead
-	return toRead, nil
+	var written int64
+	for {
+		n, err := r.Read(r.buffer)
+		if n > 0 {
+			m, werr := w.Write(r.buffer[:n])
+			written += int64(m)
+			if werr == nil && m < n {
+				werr = io.ErrShortWrite
+			}
+			if werr != nil {
+				return written, werr
+			}
+		}
+
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
 }
 
+// NewReader returns a reader decrypting r with the keystream read from prng.
 func NewReader(r io.Reader, prng io.Reader) io.Reader {
-	return &BufferedReader{
-		reader: r, encryptor: prng,
-		bufferReader: make([]byte, bufferCapacity), bufferEncryptor: make([]byte, bufferCapacity),
-		offsetReader: bufferCapacity, offsetEncryptor: bufferCapacity}
+	return NewReaderSize(r, prng, DefaultBufferSize)
 }
 
+// NewReaderSize is like NewReader, but buffers size bytes of the keystream.
+//
+// A single Read never returns more than size bytes.
+func NewReaderSize(r io.Reader, prng io.Reader, size int) *BufferedReader {
+	return &BufferedReader{reader: r, key: newKeystream(prng, size)}
+}
+
+// BufferedWriter encrypts data and writes it to the underlying writer.
 type BufferedWriter struct {
-	writer          io.Writer
-	encryptor       io.Reader
-	bufferEncryptor []byte
-	offsetEncryptor int
+	writer io.Writer
+	key    keystream
+	buffer []byte
 }
 
-func (w *BufferedWriter) Write(arr []byte) (int, error) {
-	indexArr := 0
-	for indexArr < len(arr) {
-		if len(w.bufferEncryptor) == w.offsetEncryptor {
-			_, _ = w.encryptor.Read(w.bufferEncryptor)
-			w.offsetEncryptor = 0
+// Write encrypts p into an internal buffer, p itself is never modified.
+//
+// The keystream advances only by the number of bytes accepted by the underlying writer,
+// so a failed Write may be retried with the rest of p.
+func (w *BufferedWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		key, err := w.key.next(len(p) - written)
+		if err != nil {
+			return written, err
 		}
-		toWrite := min(len(w.bufferEncryptor)-w.offsetEncryptor, len(arr)-indexArr)
-		ans := make([]byte, toWrite)
-		for i := 0; i < toWrite; i++ {
-			ans[i] = w.bufferEncryptor[w.offsetEncryptor+i] ^ arr[indexArr+i]
+
+		chunk := w.buffer[:subtle.XORBytes(w.buffer, p[written:], key)]
+		n, err := w.writer.Write(chunk)
+		w.key.skip(n)
+		written += n
+		if err == nil && n < len(chunk) {
+			err = io.ErrShortWrite
 		}
-		size, err := w.writer.Write(ans)
-		indexArr += toWrite
-		w.offsetEncryptor += toWrite
-		if size == 0 || err != nil {
-			return indexArr, err
+		if err != nil {
+			return written, err
 		}
 	}
-	return len(arr), nil
+	return written, nil
 }
 
+// ReadFrom implements io.ReaderFrom, so that io.Copy encrypts data in place.
+//
+// The input is read before the keystream, so that only as many keystream bytes
+// are requested as there are input bytes.
+func (w *BufferedWriter) ReadFrom(r io.Reader) (int64, error) {
+	var written int64
+	for {
+		n, rerr := r.Read(w.buffer)
+		for done := 0; done < n; {
+			key, err := w.key.next(n - done)
+			if err != nil {
+				return written, err
+			}
+
+			chunk := w.buffer[done : done+len(key)]
+			subtle.XORBytes(chunk, chunk, key)
+			m, werr := w.writer.Write(chunk)
+			w.key.skip(m)
+			written += int64(m)
+			done += m
+			if werr == nil && m < len(chunk) {
+				werr = io.ErrShortWrite
+			}
+			if werr != nil {
+				return written, werr
+			}
+		}
+
+		if rerr == io.EOF {
+			return written, nil
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+}
+
+// NewWriter returns a writer encrypting data with the keystream read from prng.
 func NewWriter(w io.Writer, prng io.Reader) io.Writer {
-	return &BufferedWriter{
-		writer: w, encryptor: prng,
-		bufferEncryptor: make([]byte, bufferCapacity), offsetEncryptor: bufferCapacity}
+	return NewWriterSize(w, prng, DefaultBufferSize)
+}
+
+// NewWriterSize is like NewWriter, but encrypts data in chunks of size bytes.
+func NewWriterSize(w io.Writer, prng io.Reader, size int) *BufferedWriter {
+	key := newKeystream(prng, size)
+	return &BufferedWriter{writer: w, key: key, buffer: make([]byte, cap(key.buffer))}
 }
+
+var (
+	_ io.WriterTo   = (*BufferedReader)(nil)
+	_ io.ReaderFrom = (*BufferedWriter)(nil)
+)
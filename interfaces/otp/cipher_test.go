@@ -3,6 +3,7 @@ package otp
 import (
 	"bytes"
 	"crypto/rand"
+	"fmt"
 	"io"
 	"testing"
 	"testing/iotest"
@@ -148,3 +149,131 @@ func TestWriterError(t *testing.T) {
 	require.Equal(t, 512, n)
 	require.Equal(t, out.buf.Bytes(), ciphertext[:512])
 }
+
+func TestCopy(t *testing.T) {
+	for _, size := range []int{1, 7, 32, DefaultBufferSize} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			var encrypted bytes.Buffer
+			w := NewWriterSize(&encrypted, bytes.NewReader(randomBytes), size)
+
+			n, err := io.Copy(w, iotest.HalfReader(bytes.NewReader(plaintext)))
+			require.NoError(t, err)
+			require.Equal(t, int64(testSize), n)
+			require.Equal(t, ciphertext, encrypted.Bytes())
+
+			var decrypted bytes.Buffer
+			r := NewReaderSize(iotest.HalfReader(&encrypted), bytes.NewReader(randomBytes), size)
+
+			n, err = io.Copy(&decrypted, r)
+			require.NoError(t, err)
+			require.Equal(t, int64(testSize), n)
+			require.Equal(t, plaintext, decrypted.Bytes())
+		})
+	}
+}
+
+func TestCopy_prngNotWasted(t *testing.T) {
+	prng := bytes.NewReader(randomBytes)
+	w := NewWriter(io.Discard, prng)
+
+	// A reader without WriteTo, so that io.Copy uses ReadFrom.
+	n, err := io.Copy(w, iotest.HalfReader(bytes.NewReader(plaintext[:100])))
+	require.NoError(t, err)
+	require.Equal(t, int64(100), n)
+	require.Equal(t, testSize-100, prng.Len(), "only the keystream bytes for the input may be read")
+}
+
+func TestReader_prngExhausted(t *testing.T) {
+	r := NewReader(bytes.NewReader(plaintext), bytes.NewReader(randomBytes[:100]))
+
+	buf, err := io.ReadAll(r)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.Equal(t, ciphertext[:100], buf)
+}
+
+func TestReader_prngError(t *testing.T) {
+	r := NewReader(bytes.NewReader(plaintext), iotest.ErrReader(iotest.ErrTimeout))
+
+	_, err := io.ReadAll(r)
+	require.ErrorIs(t, err, iotest.ErrTimeout)
+}
+
+func TestWriter_prngExhausted(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out, iotest.HalfReader(bytes.NewReader(randomBytes[:100])))
+
+	n, err := w.Write(plaintext)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.Equal(t, 100, n)
+	require.Equal(t, ciphertext[:100], out.Bytes())
+}
+
+func TestWriter_retry(t *testing.T) {
+	out := &errWriter{n: 500}
+	w := NewWriterSize(out, bytes.NewReader(randomBytes), 64)
+
+	n, err := w.Write(plaintext)
+	require.ErrorIs(t, err, iotest.ErrTimeout)
+	require.Equal(t, 500, n)
+
+	out.n = testSize
+	m, err := w.Write(plaintext[n:])
+	require.NoError(t, err)
+	require.Equal(t, testSize-n, m)
+	require.Equal(t, ciphertext, out.buf.Bytes())
+}
+
+func TestAllocs(t *testing.T) {
+	data := make([]byte, 4096)
+	prng := &zeroReader{}
+
+	w := NewWriter(io.Discard, prng)
+	require.Zero(t, testing.AllocsPerRun(100, func() {
+		_, _ = w.Write(data)
+	}))
+
+	r := NewReader(&zeroReader{}, prng)
+	require.Zero(t, testing.AllocsPerRun(100, func() {
+		_, _ = r.Read(data)
+	}))
+}
+
+// zeroReader is an infinite stream of zeroes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+const benchmarkSize = 64 << 20
+
+func BenchmarkWriter(b *testing.B) {
+	for _, size := range []int{32, 4 << 10, DefaultBufferSize} {
+		b.Run(fmt.Sprintf("buffer=%d", size), func(b *testing.B) {
+			b.SetBytes(benchmarkSize)
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				w := NewWriterSize(io.Discard, zeroReader{}, size)
+				_, err := io.Copy(w, io.LimitReader(zeroReader{}, benchmarkSize))
+				require.NoError(b, err)
+			}
+		})
+	}
+}
+
+func BenchmarkReader(b *testing.B) {
+	for _, size := range []int{32, 4 << 10, DefaultBufferSize} {
+		b.Run(fmt.Sprintf("buffer=%d", size), func(b *testing.B) {
+			b.SetBytes(benchmarkSize)
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				r := NewReaderSize(io.LimitReader(zeroReader{}, benchmarkSize), zeroReader{}, size)
+				_, err := io.Copy(io.Discard, r)
+				require.NoError(b, err)
+			}
+		})
+	}
+}
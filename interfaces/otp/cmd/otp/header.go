@@ -0,0 +1,114 @@
+//go:build !solution
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	headerVersion = 1
+
+	// algPad xors data with a one-time pad file starting at the offset stored in the header.
+	algPad = 1
+	// algScrypt xors data with an AES-CTR keystream derived from a passphrase.
+	algScrypt = 2
+
+	saltSize  = 16
+	checkSize = 8
+
+	// maxScryptLogN and maxScryptCost bound the scrypt parameters read from a header,
+	// as they are not authenticated before the key is derived. The cost is the number
+	// of bytes scrypt mixes, 128·r·p·N, scrypt needs 128·r·N bytes of memory.
+	maxScryptLogN = 20
+	maxScryptCost = 1 << 30
+)
+
+var headerMagic = [4]byte{'O', 'T', 'P', 'F'}
+
+var errInvalidHeader = errors.New("not an otp file or unsupported version")
+
+// header precedes the ciphertext:
+//
+//	magic (4) | version (1) | algorithm (1) | parameters
+//
+// The parameters of algPad are the pad offset (8), the parameters of algScrypt are
+// log2(N) (1) | r (1) | p (1) | salt (16) | passphrase check value (8).
+type header struct {
+	alg byte
+
+	offset int64
+
+	logN, r, p uint8
+	salt       [saltSize]byte
+	check      [checkSize]byte
+}
+
+func (h *header) MarshalBinary() ([]byte, error) {
+	b := append(headerMagic[:0:0], headerMagic[:]...)
+	b = append(b, headerVersion, h.alg)
+
+	switch h.alg {
+	case algPad:
+		b = binary.BigEndian.AppendUint64(b, uint64(h.offset))
+	case algScrypt:
+		b = append(b, h.logN, h.r, h.p)
+		b = append(b, h.salt[:]...)
+		b = append(b, h.check[:]...)
+	default:
+		return nil, fmt.Errorf("unknown algorithm %d", h.alg)
+	}
+	return b, nil
+}
+
+func readHeader(r io.Reader) (*header, error) {
+	prefix := make([]byte, len(headerMagic)+2)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, errInvalidHeader
+		}
+		return nil, err
+	}
+	if !bytes.Equal(prefix[:len(headerMagic)], headerMagic[:]) || prefix[len(headerMagic)] != headerVersion {
+		return nil, errInvalidHeader
+	}
+
+	h := &header{alg: prefix[len(headerMagic)+1]}
+
+	var params []byte
+	switch h.alg {
+	case algPad:
+		params = make([]byte, 8)
+	case algScrypt:
+		params = make([]byte, 3+saltSize+checkSize)
+	default:
+		return nil, fmt.Errorf("unknown algorithm %d", h.alg)
+	}
+
+	if _, err := io.ReadFull(r, params); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, errInvalidHeader
+		}
+		return nil, err
+	}
+
+	switch h.alg {
+	case algPad:
+		h.offset = int64(binary.BigEndian.Uint64(params))
+		if h.offset < 0 {
+			return nil, errInvalidHeader
+		}
+	case algScrypt:
+		h.logN, h.r, h.p = params[0], params[1], params[2]
+		if h.logN == 0 || h.logN > maxScryptLogN || h.r == 0 || h.p == 0 || 128*int64(h.r)*int64(h.p)<<h.logN > maxScryptCost {
+			return nil, fmt.Errorf("%w: unsupported scrypt parameters N=2^%d, r=%d, p=%d", errInvalidHeader, h.logN, h.r, h.p)
+		}
+		copy(h.salt[:], params[3:])
+		copy(h.check[:], params[3+saltSize:])
+	}
+	return h, nil
+}
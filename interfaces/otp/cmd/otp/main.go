@@ -0,0 +1,331 @@
+//go:build !solution
+
+// Command otp encrypts and decrypts files with the otp stream cipher.
+//
+// Usage:
+//
+//	otp encrypt|decrypt [flags]
+//
+// The keystream is either a one-time pad file (-pad) or is derived from a passphrase
+// with scrypt (-passphrase-file or -passphrase-env). Data is read from -in and written
+// to -out, which default to stdin and stdout.
+//
+// Every byte of a one-time pad may be used only once. Encryption records pad ranges
+// in a log next to the pad (-pad-log, pad.used by default) before using them and refuses
+// to encrypt with a range that was already used. The ciphertext header stores the pad offset,
+// so decryption needs only the pad itself.
+//
+// otp provides no integrity protection: use aeadstream to detect modified ciphertexts.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+
+	"gitlab.com/slon/shad-go/otp"
+)
+
+// Default scrypt parameters, see the recommendations in the scrypt package.
+const (
+	scryptLogN = 15
+	scryptR    = 8
+	scryptP    = 1
+)
+
+var errWrongPassphrase = errors.New("wrong passphrase")
+
+type config struct {
+	decrypt bool
+
+	in, out string
+
+	pad    string
+	padLog string
+	offset int64
+
+	passphraseFile string
+	passphraseEnv  string
+}
+
+func parseArgs(args []string) (*config, error) {
+	if len(args) == 0 || (args[0] != "encrypt" && args[0] != "decrypt") {
+		return nil, errors.New("usage: otp encrypt|decrypt [flags]")
+	}
+
+	cfg := &config{decrypt: args[0] == "decrypt"}
+
+	flags := flag.NewFlagSet("otp "+args[0], flag.ContinueOnError)
+	flags.StringVar(&cfg.in, "in", "", "input file, stdin by default")
+	flags.StringVar(&cfg.out, "out", "", "output file, stdout by default")
+	flags.StringVar(&cfg.pad, "pad", "", "one-time pad file")
+	flags.StringVar(&cfg.padLog, "pad-log", "", "log of used pad ranges, pad.used by default")
+	flags.Int64Var(&cfg.offset, "offset", -1, "pad offset to encrypt with, the first never used offset by default")
+	flags.StringVar(&cfg.passphraseFile, "passphrase-file", "", "file with the passphrase")
+	flags.StringVar(&cfg.passphraseEnv, "passphrase-env", "", "environment variable with the passphrase")
+	if err := flags.Parse(args[1:]); err != nil {
+		return nil, err
+	}
+	if flags.NArg() != 0 {
+		return nil, fmt.Errorf("unexpected arguments %q", flags.Args())
+	}
+
+	keys := 0
+	for _, key := range []string{cfg.pad, cfg.passphraseFile, cfg.passphraseEnv} {
+		if key != "" {
+			keys++
+		}
+	}
+	if keys != 1 {
+		return nil, errors.New("exactly one of -pad, -passphrase-file and -passphrase-env is required")
+	}
+	if cfg.pad == "" && (cfg.padLog != "" || cfg.offset >= 0) {
+		return nil, errors.New("-pad-log and -offset require -pad")
+	}
+	if cfg.padLog == "" {
+		cfg.padLog = cfg.pad + ".used"
+	}
+	return cfg, nil
+}
+
+func (cfg *config) passphrase() ([]byte, error) {
+	if cfg.passphraseEnv != "" {
+		passphrase, ok := os.LookupEnv(cfg.passphraseEnv)
+		if !ok || passphrase == "" {
+			return nil, fmt.Errorf("environment variable %s is empty", cfg.passphraseEnv)
+		}
+		return []byte(passphrase), nil
+	}
+
+	passphrase, err := os.ReadFile(cfg.passphraseFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) > 0 && passphrase[len(passphrase)-1] == '\n' {
+		passphrase = passphrase[:len(passphrase)-1]
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase file %s is empty", cfg.passphraseFile)
+	}
+	return passphrase, nil
+}
+
+// deriveKeystream derives the AES-CTR keystream and the passphrase check value from h.
+func deriveKeystream(passphrase []byte, h *header) (*otp.CTRKeystream, [checkSize]byte, error) {
+	var check [checkSize]byte
+
+	key, err := scrypt.Key(passphrase, h.salt[:], 1<<h.logN, int(h.r), int(h.p), 32+16+checkSize)
+	if err != nil {
+		return nil, check, err
+	}
+
+	ks, err := otp.NewCTRKeystream(key[:32], key[32:48])
+	copy(check[:], key[48:])
+	return ks, check, err
+}
+
+func encrypt(cfg *config, in io.Reader, out io.Writer) error {
+	if cfg.pad != "" {
+		return encryptPad(cfg, in, out)
+	}
+
+	passphrase, err := cfg.passphrase()
+	if err != nil {
+		return err
+	}
+
+	h := &header{alg: algScrypt, logN: scryptLogN, r: scryptR, p: scryptP}
+	if _, err := rand.Read(h.salt[:]); err != nil {
+		return err
+	}
+
+	var ks *otp.CTRKeystream
+	ks, h.check, err = deriveKeystream(passphrase, h)
+	if err != nil {
+		return err
+	}
+	_, err = encryptStream(out, in, h, ks)
+	return err
+}
+
+func encryptPad(cfg *config, in io.Reader, out io.Writer) (err error) {
+	pad, err := os.Open(cfg.pad)
+	if err != nil {
+		return err
+	}
+	defer pad.Close()
+
+	padInfo, err := pad.Stat()
+	if err != nil {
+		return err
+	}
+
+	log, err := openPadLog(cfg.padLog)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, log.Close())
+	}()
+
+	offset := cfg.offset
+	if offset < 0 {
+		offset = log.next()
+	}
+
+	end, err := log.free(offset)
+	if err != nil {
+		return err
+	}
+	end = min(end, padInfo.Size())
+	if offset >= end {
+		return fmt.Errorf("no unused pad left at offset %d", offset)
+	}
+
+	sized := false
+	if f, ok := in.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+			if info.Size() > end-offset {
+				return fmt.Errorf("input is %d bytes long, but only %d bytes of pad are unused at offset %d", info.Size(), end-offset, offset)
+			}
+			end, sized = offset+info.Size(), true
+		}
+	}
+
+	// The section ends at the next used range, so encryption can not run into it.
+	// Pad bytes are reserved in the log before they are used and are never released,
+	// so a failed or interrupted encryption can not leave a used range unrecorded.
+	ks := &reservingKeystream{
+		ks:       otp.NewPadKeystream(io.NewSectionReader(pad, 0, end)),
+		log:      log,
+		reserved: offset,
+		end:      end,
+	}
+	if sized {
+		if err := ks.reserve(end); err != nil {
+			return err
+		}
+	}
+
+	h := &header{alg: algPad, offset: offset}
+	written, err := encryptStream(out, in, h, ks)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("pad exhausted after %d bytes: %w", written, err)
+	}
+	return err
+}
+
+// encryptStream writes the header and the encrypted input, it returns
+// the number of keystream bytes used.
+func encryptStream(out io.Writer, in io.Reader, h *header, ks otp.Keystream) (int64, error) {
+	b, err := h.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := out.Write(b); err != nil {
+		return 0, err
+	}
+
+	w := otp.NewWriter(out, otp.NewKeystreamReader(ks, h.offset))
+	return io.Copy(w, in)
+}
+
+func decrypt(cfg *config, in io.Reader, out io.Writer) error {
+	h, err := readHeader(in)
+	if err != nil {
+		return err
+	}
+
+	var ks otp.Keystream
+	switch h.alg {
+	case algPad:
+		if cfg.pad == "" {
+			return errors.New("input is encrypted with a one-time pad, -pad is required")
+		}
+
+		pad, err := os.Open(cfg.pad)
+		if err != nil {
+			return err
+		}
+		defer pad.Close()
+
+		ks = otp.NewPadKeystream(pad)
+
+	case algScrypt:
+		if cfg.pad != "" {
+			return errors.New("input is encrypted with a passphrase")
+		}
+
+		passphrase, err := cfg.passphrase()
+		if err != nil {
+			return err
+		}
+
+		var check [checkSize]byte
+		ks, check, err = deriveKeystream(passphrase, h)
+		if err != nil {
+			return err
+		}
+		if subtle.ConstantTimeCompare(check[:], h.check[:]) != 1 {
+			return errWrongPassphrase
+		}
+	}
+
+	_, err = io.Copy(out, otp.NewReader(in, otp.NewKeystreamReader(ks, h.offset)))
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("pad is shorter than the ciphertext: %w", err)
+	}
+	return err
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) (err error) {
+	cfg, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+
+	in := stdin
+	if cfg.in != "" {
+		f, err := os.Open(cfg.in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	out := stdout
+	if cfg.out != "" {
+		f, openErr := os.OpenFile(cfg.out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if openErr != nil {
+			return openErr
+		}
+		defer func() {
+			err = errors.Join(err, f.Close())
+			if err != nil {
+				_ = os.Remove(cfg.out)
+			}
+		}()
+		out = f
+	}
+
+	if cfg.decrypt {
+		return decrypt(cfg, in, out)
+	}
+	return encrypt(cfg, in, out)
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "otp:", err)
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeRandomFile(t *testing.T, path string, size int) []byte {
+	t.Helper()
+
+	data := make([]byte, size)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return data
+}
+
+func runBytes(t *testing.T, input []byte, args ...string) ([]byte, error) {
+	t.Helper()
+
+	var out bytes.Buffer
+	err := run(args, bytes.NewReader(input), &out)
+	return out.Bytes(), err
+}
+
+func TestPad_roundTrip(t *testing.T) {
+	dir := t.TempDir()
+	pad := filepath.Join(dir, "pad")
+	padBytes := writeRandomFile(t, pad, 1000)
+
+	first := []byte("attack at dawn")
+	second := []byte("retreat at dusk")
+
+	firstCiphertext, err := runBytes(t, first, "encrypt", "-pad", pad)
+	require.NoError(t, err)
+	secondCiphertext, err := runBytes(t, second, "encrypt", "-pad", pad)
+	require.NoError(t, err)
+
+	h, err := readHeader(bytes.NewReader(secondCiphertext))
+	require.NoError(t, err)
+	require.Equal(t, int64(len(first)), h.offset, "the second message must not reuse the pad")
+
+	body := secondCiphertext[len(secondCiphertext)-len(second):]
+	for i := range body {
+		require.Equal(t, second[i]^padBytes[len(first)+i], body[i])
+	}
+
+	for _, tc := range []struct{ ciphertext, plaintext []byte }{
+		{firstCiphertext, first},
+		{secondCiphertext, second},
+	} {
+		decrypted, err := runBytes(t, tc.ciphertext, "decrypt", "-pad", pad)
+		require.NoError(t, err)
+		require.Equal(t, tc.plaintext, decrypted)
+	}
+
+	used, err := os.ReadFile(pad + ".used")
+	require.NoError(t, err)
+	require.Equal(t, "0 14\n14 29\n", string(used))
+}
+
+// pipe returns the read end of a pipe holding data, like the stdin of "echo data | otp".
+func pipe(t *testing.T, data []byte) *os.File {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = r.Close() })
+
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return r
+}
+
+func TestPad_pipe(t *testing.T) {
+	dir := t.TempDir()
+	pad := filepath.Join(dir, "pad")
+	writeRandomFile(t, pad, 1000)
+
+	for _, msg := range []string{"attack at dawn", "retreat at dusk"} {
+		var out bytes.Buffer
+		require.NoError(t, run([]string{"encrypt", "-pad", pad}, pipe(t, []byte(msg)), &out))
+
+		decrypted, err := runBytes(t, out.Bytes(), "decrypt", "-pad", pad)
+		require.NoError(t, err)
+		require.Equal(t, msg, string(decrypted))
+	}
+
+	used, err := os.ReadFile(pad + ".used")
+	require.NoError(t, err)
+	require.Equal(t, "0 14\n14 29\n", string(used), "only the pad bytes of the input may be used")
+}
+
+func TestPad_files(t *testing.T) {
+	dir := t.TempDir()
+	pad := filepath.Join(dir, "pad")
+	writeRandomFile(t, pad, 100<<10)
+
+	in := filepath.Join(dir, "in")
+	plaintext := writeRandomFile(t, in, 64<<10)
+
+	encrypted := filepath.Join(dir, "in.otp")
+	require.NoError(t, run([]string{"encrypt", "-pad", pad, "-in", in, "-out", encrypted}, nil, nil))
+
+	decrypted := filepath.Join(dir, "out")
+	require.NoError(t, run([]string{"decrypt", "-pad", pad, "-in", encrypted, "-out", decrypted}, nil, nil))
+
+	result, err := os.ReadFile(decrypted)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, result)
+
+	err = run([]string{"encrypt", "-pad", pad, "-in", in, "-out", filepath.Join(dir, "again.otp")}, nil, nil)
+	require.ErrorContains(t, err, "only 36864 bytes of pad are unused")
+	require.NoFileExists(t, filepath.Join(dir, "again.otp"))
+}
+
+func TestPad_reuse(t *testing.T) {
+	dir := t.TempDir()
+	pad := filepath.Join(dir, "pad")
+	writeRandomFile(t, pad, 100)
+
+	_, err := runBytes(t, make([]byte, 10), "encrypt", "-pad", pad, "-offset", "20")
+	require.NoError(t, err)
+
+	_, err = runBytes(t, []byte("x"), "encrypt", "-pad", pad, "-offset", "25")
+	require.ErrorContains(t, err, "already used")
+
+	_, err = runBytes(t, make([]byte, 5), "encrypt", "-pad", pad, "-offset", "15")
+	require.NoError(t, err)
+
+	// The stream runs into the range used above, the reserved prefix stays recorded.
+	_, err = runBytes(t, make([]byte, 10), "encrypt", "-pad", pad, "-offset", "10")
+	require.ErrorContains(t, err, "pad exhausted after 5 bytes")
+
+	_, err = runBytes(t, []byte("x"), "encrypt", "-pad", pad, "-offset", "12")
+	require.ErrorContains(t, err, "already used")
+
+	used, err := os.ReadFile(pad + ".used")
+	require.NoError(t, err)
+	require.Equal(t, "20 30\n15 20\n10 15\n", string(used))
+}
+
+func TestPad_locked(t *testing.T) {
+	dir := t.TempDir()
+	pad := filepath.Join(dir, "pad")
+	writeRandomFile(t, pad, 100)
+
+	log, err := openPadLog(pad + ".used")
+	require.NoError(t, err)
+
+	_, err = runBytes(t, []byte("x"), "encrypt", "-pad", pad)
+	require.ErrorContains(t, err, "in use")
+
+	require.NoError(t, log.Close())
+	_, err = runBytes(t, []byte("x"), "encrypt", "-pad", pad)
+	require.NoError(t, err)
+}
+
+func TestPassphrase(t *testing.T) {
+	t.Setenv("OTP_TEST_PASSPHRASE", "correct horse battery staple")
+
+	plaintext := []byte(strings.Repeat("attack at dawn\n", 1000))
+	ciphertext, err := runBytes(t, plaintext, "encrypt", "-passphrase-env", "OTP_TEST_PASSPHRASE")
+	require.NoError(t, err)
+
+	again, err := runBytes(t, plaintext, "encrypt", "-passphrase-env", "OTP_TEST_PASSPHRASE")
+	require.NoError(t, err)
+	require.NotEqual(t, ciphertext, again, "every encryption must use a fresh salt")
+
+	decrypted, err := runBytes(t, ciphertext, "decrypt", "-passphrase-env", "OTP_TEST_PASSPHRASE")
+	require.NoError(t, err)
+	require.Equal(t, plaintext, decrypted)
+
+	passphraseFile := filepath.Join(t.TempDir(), "passphrase")
+	require.NoError(t, os.WriteFile(passphraseFile, []byte("correct horse battery staple\n"), 0o600))
+	decrypted, err = runBytes(t, ciphertext, "decrypt", "-passphrase-file", passphraseFile)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, decrypted)
+
+	t.Setenv("OTP_TEST_PASSPHRASE", "incorrect horse")
+	_, err = runBytes(t, ciphertext, "decrypt", "-passphrase-env", "OTP_TEST_PASSPHRASE")
+	require.ErrorIs(t, err, errWrongPassphrase)
+}
+
+func TestDecrypt_invalidHeader(t *testing.T) {
+	t.Setenv("OTP_TEST_PASSPHRASE", "secret")
+
+	_, err := runBytes(t, []byte("OTPF"), "decrypt", "-passphrase-env", "OTP_TEST_PASSPHRASE")
+	require.ErrorIs(t, err, errInvalidHeader)
+
+	_, err = runBytes(t, []byte("plain text, not encrypted"), "decrypt", "-passphrase-env", "OTP_TEST_PASSPHRASE")
+	require.ErrorIs(t, err, errInvalidHeader)
+
+	for _, params := range [][3]uint8{{63, 8, 1}, {0, 8, 1}, {21, 1, 1}, {20, 16, 1}, {15, 8, 0}, {15, 255, 255}} {
+		h := &header{alg: algScrypt, logN: params[0], r: params[1], p: params[2]}
+		b, err := h.MarshalBinary()
+		require.NoError(t, err)
+
+		_, err = runBytes(t, b, "decrypt", "-passphrase-env", "OTP_TEST_PASSPHRASE")
+		require.ErrorIs(t, err, errInvalidHeader, "%v", params)
+	}
+}
+
+func TestPad_reservedBeforeUse(t *testing.T) {
+	dir := t.TempDir()
+	pad := filepath.Join(dir, "pad")
+	writeRandomFile(t, pad, 100)
+
+	// The output fails after the header, the pad range is reserved anyway.
+	err := run([]string{"encrypt", "-pad", pad}, bytes.NewReader(make([]byte, 10)), &failingWriter{n: 1})
+	require.Error(t, err)
+
+	used, err := os.ReadFile(pad + ".used")
+	require.NoError(t, err)
+	require.Equal(t, "0 10\n", string(used))
+}
+
+// failingWriter accepts n writes and fails the rest.
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errors.New("write failed")
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestParseArgs(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"compress"},
+		{"encrypt"},
+		{"encrypt", "-pad", "pad", "-passphrase-env", "X"},
+		{"encrypt", "-passphrase-env", "X", "-offset", "10"},
+		{"encrypt", "-pad", "pad", "extra"},
+	} {
+		_, err := parseArgs(args)
+		require.Error(t, err, "%q", args)
+	}
+}
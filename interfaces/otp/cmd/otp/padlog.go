@@ -0,0 +1,159 @@
+//go:build !solution
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"sync"
+
+	"gitlab.com/slon/shad-go/otp"
+)
+
+// padRange is a half-open range [start, end) of pad bytes.
+type padRange struct {
+	start, end int64
+}
+
+// padLog tracks the ranges of a one-time pad that were already used for encryption.
+//
+// The log is a text file with a "start end" line per range. It is locked
+// by an adjacent lock file for as long as the padLog is open, so that concurrent
+// encryptions can not pick the same range.
+type padLog struct {
+	path   string
+	ranges []padRange
+}
+
+func openPadLog(path string) (*padLog, error) {
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("pad log %s is in use, remove %s.lock if no other otp is running", path, path)
+		}
+		return nil, err
+	}
+	if err := lock.Close(); err != nil {
+		return nil, err
+	}
+
+	l := &padLog{path: path}
+	if err := l.load(); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *padLog) load() error {
+	f, err := os.Open(l.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var r padRange
+		if _, err := fmt.Sscanf(scanner.Text(), "%d %d", &r.start, &r.end); err != nil || r.start < 0 || r.end < r.start {
+			return fmt.Errorf("%s:%d: malformed pad range %q", l.path, line, scanner.Text())
+		}
+		l.ranges = append(l.ranges, r)
+	}
+	return scanner.Err()
+}
+
+// next returns the offset following all used ranges.
+func (l *padLog) next() int64 {
+	var offset int64
+	for _, r := range l.ranges {
+		offset = max(offset, r.end)
+	}
+	return offset
+}
+
+// free returns the end of the unused range starting at offset.
+func (l *padLog) free(offset int64) (int64, error) {
+	end := int64(math.MaxInt64)
+	for _, r := range l.ranges {
+		if r.start <= offset && offset < r.end {
+			return 0, fmt.Errorf("pad offset %d was already used by range [%d, %d)", offset, r.start, r.end)
+		}
+		if r.start > offset {
+			end = min(end, r.start)
+		}
+	}
+	return end, nil
+}
+
+// record appends r to the log and syncs it to disk.
+func (l *padLog) record(r padRange) error {
+	if r.start == r.end {
+		return nil
+	}
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%d %d\n", r.start, r.end); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	l.ranges = append(l.ranges, r)
+	return nil
+}
+
+// Close releases the lock.
+func (l *padLog) Close() error {
+	return os.Remove(l.path + ".lock")
+}
+
+// reservingKeystream records the pad bytes in the log before ks produces them.
+// Bytes are reserved up to end only.
+type reservingKeystream struct {
+	ks  otp.Keystream
+	log *padLog
+
+	mu       sync.Mutex
+	reserved int64
+	end      int64
+}
+
+// reserve records the range from the reserved end up to end in the log.
+func (k *reservingKeystream) reserve(end int64) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	end = min(end, k.end)
+	if end <= k.reserved {
+		return nil
+	}
+	if err := k.log.record(padRange{start: k.reserved, end: end}); err != nil {
+		return fmt.Errorf("reserving pad range [%d, %d): %w", k.reserved, end, err)
+	}
+	k.reserved = end
+	return nil
+}
+
+func (k *reservingKeystream) XORKeyStreamAt(dst, src []byte, offset int64) (int, error) {
+	if err := k.reserve(offset + int64(len(src))); err != nil {
+		return 0, err
+	}
+	return k.ks.XORKeyStreamAt(dst, src, offset)
+}
@@ -0,0 +1,136 @@
+//go:build !solution
+
+package otp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Keystream is a keystream that can be generated starting from any offset.
+type Keystream interface {
+	// XORKeyStreamAt xors src with the keystream bytes starting at offset and writes
+	// the result into dst. dst and src must overlap entirely or not at all.
+	//
+	// Like io.ReaderAt, it returns the number of bytes processed and a non-nil error
+	// if the keystream ends before len(src) bytes.
+	//
+	// It is safe to call XORKeyStreamAt concurrently.
+	XORKeyStreamAt(dst, src []byte, offset int64) (int, error)
+}
+
+// CTRKeystream is an AES keystream in counter mode. The keystream block i is
+// the encryption of iv+i, so the keystream at any offset can be computed directly.
+type CTRKeystream struct {
+	block cipher.Block
+	iv    [aes.BlockSize]byte
+}
+
+func (k *CTRKeystream) XORKeyStreamAt(dst, src []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, fmt.Errorf("otp: negative keystream offset %d", offset)
+	}
+
+	var iv [aes.BlockSize]byte
+	hi := binary.BigEndian.Uint64(k.iv[:8])
+	lo := binary.BigEndian.Uint64(k.iv[8:])
+	blocks := uint64(offset / aes.BlockSize)
+	if lo+blocks < lo {
+		hi++
+	}
+	binary.BigEndian.PutUint64(iv[:8], hi)
+	binary.BigEndian.PutUint64(iv[8:], lo+blocks)
+
+	stream := cipher.NewCTR(k.block, iv[:])
+	if skip := offset % aes.BlockSize; skip != 0 {
+		var scratch [aes.BlockSize]byte
+		stream.XORKeyStream(scratch[:skip], scratch[:skip])
+	}
+	stream.XORKeyStream(dst[:len(src)], src)
+	return len(src), nil
+}
+
+// NewCTRKeystream returns an AES-CTR keystream. key must be 16, 24 or 32 bytes long
+// and iv must be 16 bytes long.
+func NewCTRKeystream(key, iv []byte) (*CTRKeystream, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("otp: %w", err)
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("otp: iv must be %d bytes long", aes.BlockSize)
+	}
+
+	k := &CTRKeystream{block: block}
+	copy(k.iv[:], iv)
+	return k, nil
+}
+
+// PadKeystream uses the contents of a one-time pad as the keystream.
+type PadKeystream struct {
+	pad io.ReaderAt
+}
+
+// ErrPadExhausted is returned when the keystream is read past the end of the pad.
+var ErrPadExhausted = errors.New("otp: one-time pad exhausted")
+
+// padBuffers holds the buffers PadKeystream reads the pad into,
+// so that XORKeyStreamAt does not allocate.
+var padBuffers = sync.Pool{
+	New: func() any {
+		b := make([]byte, 32<<10)
+		return &b
+	},
+}
+
+func (k *PadKeystream) XORKeyStreamAt(dst, src []byte, offset int64) (int, error) {
+	buf := padBuffers.Get().(*[]byte)
+	defer padBuffers.Put(buf)
+
+	key := *buf
+	for done := 0; done < len(src); {
+		chunk := key[:min(len(key), len(src)-done)]
+		n, err := k.pad.ReadAt(chunk, offset+int64(done))
+		done += subtle.XORBytes(dst[done:], src[done:done+n], chunk[:n])
+		if n < len(chunk) {
+			if err == nil || errors.Is(err, io.EOF) {
+				err = ErrPadExhausted
+			}
+			return done, err
+		}
+	}
+	return len(src), nil
+}
+
+// NewPadKeystream returns a keystream reading key bytes from pad.
+func NewPadKeystream(pad io.ReaderAt) *PadKeystream {
+	return &PadKeystream{pad: pad}
+}
+
+// keystreamReader reads a Keystream sequentially, so that it can be used as prng.
+type keystreamReader struct {
+	ks     Keystream
+	offset int64
+}
+
+func (r *keystreamReader) Read(p []byte) (int, error) {
+	clear(p)
+	n, err := r.ks.XORKeyStreamAt(p, p, r.offset)
+	r.offset += int64(n)
+	if errors.Is(err, ErrPadExhausted) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// NewKeystreamReader returns the keystream bytes of ks starting at offset,
+// suitable as the prng argument of NewReader and NewWriter.
+func NewKeystreamReader(ks Keystream, offset int64) io.Reader {
+	return &keystreamReader{ks: ks, offset: offset}
+}
@@ -0,0 +1,109 @@
+//go:build !solution
+
+package otp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNotReaderAt is returned by SeekableReader.ReadAt if the underlying reader
+// does not implement io.ReaderAt.
+var ErrNotReaderAt = errors.New("otp: underlying reader does not implement io.ReaderAt")
+
+// SeekableReader decrypts a stream encrypted with a positionable Keystream.
+//
+// Unlike the reader returned by NewReader, it supports random access.
+type SeekableReader struct {
+	reader io.ReadSeeker
+	ks     Keystream
+	// base is the offset of the underlying reader the stream starts at,
+	// offset is the current offset relative to base.
+	base   int64
+	offset int64
+	// err is the error of finding out base, returned by every call.
+	err error
+}
+
+func (r *SeekableReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		var ksErr error
+		if n, ksErr = r.ks.XORKeyStreamAt(p[:n], p[:n], r.offset); ksErr != nil {
+			err = ksErr
+		}
+		r.offset += int64(n)
+	}
+	return n, err
+}
+
+// Seek sets the offset relative to the start of the stream, so that it matches
+// the keystream offset.
+func (r *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	if whence == io.SeekStart {
+		if offset < 0 {
+			return 0, fmt.Errorf("otp: negative position %d", offset)
+		}
+		offset += r.base
+	}
+
+	pos, err := r.reader.Seek(offset, whence)
+	if err != nil {
+		return 0, err
+	}
+	if pos < r.base {
+		if _, err := r.reader.Seek(r.base+r.offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("otp: negative position %d", pos-r.base)
+	}
+	r.offset = pos - r.base
+	return r.offset, nil
+}
+
+// ReadAt decrypts len(p) bytes starting at offset off of the stream.
+// It does not change the offset used by Read.
+func (r *SeekableReader) ReadAt(p []byte, off int64) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if off < 0 {
+		return 0, fmt.Errorf("otp: negative offset %d", off)
+	}
+
+	ra, ok := r.reader.(io.ReaderAt)
+	if !ok {
+		return 0, ErrNotReaderAt
+	}
+
+	n, err := ra.ReadAt(p, r.base+off)
+	if n > 0 {
+		var ksErr error
+		if n, ksErr = r.ks.XORKeyStreamAt(p[:n], p[:n], off); ksErr != nil {
+			err = ksErr
+		}
+	}
+	return n, err
+}
+
+// NewSeekableReader returns a reader that decrypts r with ks.
+// The stream starts at the current offset of r, which is the keystream offset zero:
+// offsets of Seek and ReadAt are relative to it.
+func NewSeekableReader(r io.ReadSeeker, ks Keystream) *SeekableReader {
+	base, err := r.Seek(0, io.SeekCurrent)
+	return &SeekableReader{reader: r, ks: ks, base: base, err: err}
+}
+
+var (
+	_ io.ReadSeeker = (*SeekableReader)(nil)
+	_ io.ReaderAt   = (*SeekableReader)(nil)
+)
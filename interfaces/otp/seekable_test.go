@@ -0,0 +1,165 @@
+package otp
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testKey = []byte("0123456789abcdef")
+	testIV  = []byte{0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}
+)
+
+func newTestKeystream(t *testing.T) *CTRKeystream {
+	t.Helper()
+
+	ks, err := NewCTRKeystream(testKey, testIV)
+	require.NoError(t, err)
+	return ks
+}
+
+// encryptSequential encrypts data with NewWriter using ks as prng.
+func encryptSequential(t *testing.T, ks Keystream, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	_, err := NewWriter(&buf, NewKeystreamReader(ks, 0)).Write(data)
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+func TestSeekableReader_randomAccess(t *testing.T) {
+	for name, ks := range map[string]Keystream{
+		"ctr": newTestKeystream(t),
+		"pad": NewPadKeystream(bytes.NewReader(randomBytes)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ciphertext := encryptSequential(t, ks, plaintext)
+
+			decrypted, err := io.ReadAll(NewReader(bytes.NewReader(ciphertext), NewKeystreamReader(ks, 0)))
+			require.NoError(t, err)
+			require.Equal(t, plaintext, decrypted)
+
+			r := NewSeekableReader(bytes.NewReader(ciphertext), ks)
+			rnd := rand.New(rand.NewSource(42))
+			for i := 0; i < 200; i++ {
+				off := rnd.Intn(len(ciphertext))
+				size := rnd.Intn(len(ciphertext) - off + 1)
+
+				p := make([]byte, size)
+				n, err := r.ReadAt(p, int64(off))
+				require.NoError(t, err)
+				require.Equal(t, size, n)
+				require.Equal(t, decrypted[off:off+size], p, "ReadAt(%d, %d)", off, size)
+
+				pos, err := r.Seek(int64(off), io.SeekStart)
+				require.NoError(t, err)
+				require.Equal(t, int64(off), pos)
+
+				p = make([]byte, size)
+				_, err = io.ReadFull(r, p)
+				require.NoError(t, err)
+				require.Equal(t, decrypted[off:off+size], p, "Seek(%d) + Read(%d)", off, size)
+			}
+		})
+	}
+}
+
+func TestSeekableReader_seekEnd(t *testing.T) {
+	ks := newTestKeystream(t)
+	ciphertext := encryptSequential(t, ks, plaintext)
+
+	r := NewSeekableReader(bytes.NewReader(ciphertext), ks)
+	pos, err := r.Seek(-10, io.SeekEnd)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(plaintext)-10), pos)
+
+	tail, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, plaintext[len(plaintext)-10:], tail)
+
+	p := make([]byte, 20)
+	n, err := r.ReadAt(p, int64(len(plaintext)-5))
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, 5, n)
+	require.Equal(t, plaintext[len(plaintext)-5:], p[:n])
+}
+
+func TestSeekableReader_base(t *testing.T) {
+	ks := newTestKeystream(t)
+	header := []byte("OTPF")
+	ciphertext := encryptSequential(t, ks, plaintext)
+
+	file := bytes.NewReader(append(header, ciphertext...))
+	_, err := file.Seek(int64(len(header)), io.SeekStart)
+	require.NoError(t, err)
+
+	r := NewSeekableReader(file, ks)
+	p := make([]byte, 10)
+	_, err = io.ReadFull(r, p)
+	require.NoError(t, err)
+	require.Equal(t, plaintext[:10], p)
+
+	pos, err := r.Seek(100, io.SeekStart)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), pos)
+	_, err = io.ReadFull(r, p)
+	require.NoError(t, err)
+	require.Equal(t, plaintext[100:110], p)
+
+	pos, err = r.Seek(-10, io.SeekEnd)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(plaintext)-10), pos)
+
+	_, err = r.Seek(-int64(len(plaintext)+1), io.SeekEnd)
+	require.Error(t, err)
+	_, err = io.ReadFull(r, p)
+	require.NoError(t, err)
+	require.Equal(t, plaintext[len(plaintext)-10:], p)
+
+	_, err = r.ReadAt(p, 50)
+	require.NoError(t, err)
+	require.Equal(t, plaintext[50:60], p)
+}
+
+func TestSeekableReader_notReaderAt(t *testing.T) {
+	r := NewSeekableReader(struct{ io.ReadSeeker }{bytes.NewReader(nil)}, newTestKeystream(t))
+
+	_, err := r.ReadAt(make([]byte, 1), 0)
+	require.ErrorIs(t, err, ErrNotReaderAt)
+}
+
+func TestPadKeystream_exhausted(t *testing.T) {
+	ks := NewPadKeystream(bytes.NewReader(randomBytes[:10]))
+
+	p := make([]byte, 11)
+	n, err := ks.XORKeyStreamAt(p, p, 0)
+	require.ErrorIs(t, err, ErrPadExhausted)
+	require.Equal(t, 10, n)
+	require.Equal(t, randomBytes[:10], p[:10])
+
+	n, err = ks.XORKeyStreamAt(p[:5], p[:5], 5)
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+}
+
+func TestPadKeystream_allocs(t *testing.T) {
+	ks := NewPadKeystream(bytes.NewReader(randomBytes))
+	p := make([]byte, 1000)
+	require.Zero(t, testing.AllocsPerRun(100, func() {
+		_, err := ks.XORKeyStreamAt(p, p, 100)
+		require.NoError(t, err)
+	}))
+}
+
+func TestNewCTRKeystream_invalid(t *testing.T) {
+	_, err := NewCTRKeystream([]byte("short"), testIV)
+	require.Error(t, err)
+
+	_, err = NewCTRKeystream(testKey, testIV[:8])
+	require.Error(t, err)
+}
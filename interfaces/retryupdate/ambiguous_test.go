@@ -0,0 +1,234 @@
+package retryupdate_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/retryupdate"
+	"gitlab.com/slon/shad-go/retryupdate/kvapi"
+)
+
+// lossyClient applies the first Set, runs interfere and fails the Set as if the response timed out.
+// With failAll, every later Set fails without reaching the store.
+type lossyClient struct {
+	store     *kvapi.MemoryClient
+	interfere func(store *kvapi.MemoryClient)
+	failAll   bool
+
+	sets int
+}
+
+var errTimeout = &kvapi.APIError{Method: "set", Err: errors.New("timeout")}
+
+func (c *lossyClient) Get(req *kvapi.GetRequest) (*kvapi.GetResponse, error) {
+	return c.store.Get(req)
+}
+
+func (c *lossyClient) Set(req *kvapi.SetRequest) (*kvapi.SetResponse, error) {
+	return c.set(func() (*kvapi.SetResponse, error) { return c.store.Set(req) })
+}
+
+func (c *lossyClient) set(apply func() (*kvapi.SetResponse, error)) (*kvapi.SetResponse, error) {
+	c.sets++
+	switch {
+	case c.sets == 1:
+		if _, err := apply(); err != nil {
+			return nil, err
+		}
+		if c.interfere != nil {
+			c.interfere(c.store)
+		}
+		return nil, errTimeout
+	case c.failAll:
+		return nil, errTimeout
+	default:
+		return apply()
+	}
+}
+
+type idempotentLossyClient struct {
+	*lossyClient
+}
+
+func (c idempotentLossyClient) SetIdempotent(req *kvapi.IdempotentSetRequest) (*kvapi.SetResponse, error) {
+	return c.set(func() (*kvapi.SetResponse, error) { return c.store.SetIdempotent(req) })
+}
+
+func setValue(t *testing.T, store *kvapi.MemoryClient, value string) {
+	var oldVersion uuid.UUID
+	if rsp, err := store.Get(&kvapi.GetRequest{Key: "counter"}); err == nil {
+		oldVersion = rsp.Version
+	}
+
+	_, err := store.Set(&kvapi.SetRequest{Key: "counter", Value: value, OldVersion: oldVersion, NewVersion: uuid.Must(uuid.NewV4())})
+	require.NoError(t, err)
+}
+
+func TestUpdateValue_maybeApplied(t *testing.T) {
+	type result struct {
+		maybeApplied bool
+		value        *string
+	}
+	ptr := func(s string) *string { return &s }
+
+	for _, tc := range []struct {
+		name      string
+		interfere func(t *testing.T, store *kvapi.MemoryClient)
+
+		plain, strict, idempotent result
+	}{
+		{
+			name:       "timeoutAfterCommit",
+			plain:      result{value: ptr("2")},
+			strict:     result{value: ptr("2")},
+			idempotent: result{value: ptr("2")},
+		},
+		{
+			name: "concurrentWriter",
+			interfere: func(t *testing.T, store *kvapi.MemoryClient) {
+				setValue(t, store, "10")
+			},
+			// The increment is applied twice: once before the concurrent write, once after.
+			plain:      result{value: ptr("11")},
+			strict:     result{maybeApplied: true, value: ptr("10")},
+			idempotent: result{value: ptr("10")},
+		},
+		{
+			name: "keyDeleted",
+			interfere: func(t *testing.T, store *kvapi.MemoryClient) {
+				rsp, err := store.Get(&kvapi.GetRequest{Key: "counter"})
+				require.NoError(t, err)
+				_, err = store.Delete(&kvapi.DeleteRequest{Key: "counter", OldVersion: rsp.Version})
+				require.NoError(t, err)
+			},
+			plain:      result{value: ptr("1")},
+			strict:     result{maybeApplied: true},
+			idempotent: result{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, mode := range []struct {
+				name       string
+				idempotent bool
+				opts       retryupdate.Options
+				want       result
+			}{
+				{name: "plain", want: tc.plain},
+				{name: "strict", opts: retryupdate.Options{FailOnAmbiguousWrite: true}, want: tc.strict},
+				{name: "idempotent", idempotent: true, want: tc.idempotent},
+			} {
+				t.Run(mode.name, func(t *testing.T) {
+					store := kvapi.NewMemoryClient()
+					setValue(t, store, "1")
+
+					lossy := &lossyClient{store: store}
+					if tc.interfere != nil {
+						lossy.interfere = func(store *kvapi.MemoryClient) { tc.interfere(t, store) }
+					}
+
+					var c kvapi.Client = lossy
+					if mode.idempotent {
+						c = idempotentLossyClient{lossy}
+					}
+
+					err := retryupdate.UpdateValueWithOptions(context.Background(), c, "counter", increment, mode.opts)
+					if mode.want.maybeApplied {
+						require.ErrorIs(t, err, retryupdate.ErrMaybeApplied)
+
+						var errMaybeApplied *retryupdate.MaybeAppliedError
+						require.ErrorAs(t, err, &errMaybeApplied)
+						require.Equal(t, "counter", errMaybeApplied.Key)
+					} else {
+						require.NoError(t, err)
+					}
+
+					rsp, err := store.Get(&kvapi.GetRequest{Key: "counter"})
+					if mode.want.value == nil {
+						require.ErrorIs(t, err, kvapi.ErrKeyNotFound)
+					} else {
+						require.NoError(t, err)
+						require.Equal(t, *mode.want.value, rsp.Value)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestUpdateValue_maybeAppliedRetriesExhausted(t *testing.T) {
+	store := kvapi.NewMemoryClient()
+	c := &lossyClient{store: store, failAll: true}
+
+	backoff := &retryupdate.ExponentialBackoff{Initial: time.Millisecond, MaxAttempts: 3}
+	err := retryupdate.UpdateValueContext(context.Background(), c, "counter", increment, backoff)
+	require.ErrorIs(t, err, retryupdate.ErrMaybeApplied)
+	require.ErrorIs(t, err, retryupdate.ErrRetriesExhausted)
+
+	var retryErr *retryupdate.RetryError
+	require.ErrorAs(t, err, &retryErr)
+
+	rsp, err := store.Get(&kvapi.GetRequest{Key: "counter"})
+	require.NoError(t, err)
+	require.Equal(t, "1", rsp.Value)
+}
+
+func TestUpdateValue_notAppliedIsNotAmbiguous(t *testing.T) {
+	store := kvapi.NewMemoryClient()
+	c := kvapi.NewFaultyClient(store, kvapi.FaultOptions{AuthErrorRate: 1})
+
+	err := retryupdate.UpdateValueContext(context.Background(), c, "counter", increment, retryupdate.NoBackoff)
+	var authErr *kvapi.AuthError
+	require.ErrorAs(t, err, &authErr)
+	require.NotErrorIs(t, err, retryupdate.ErrMaybeApplied)
+}
+
+// plainClient hides the optional interfaces of the wrapped client.
+type plainClient struct {
+	kvapi.Client
+}
+
+func TestUpdateValue_idempotentNotSupported(t *testing.T) {
+	store := kvapi.NewMemoryClient()
+	setValue(t, store, "1")
+
+	srv := httptest.NewServer(kvapi.NewHandler(plainClient{store}, ""))
+	defer srv.Close()
+
+	// The handler serves SetIdempotent of FaultyClient, which fails with ErrNotSupported.
+	faultySrv := httptest.NewServer(kvapi.NewHandler(kvapi.NewFaultyClient(plainClient{store}, kvapi.FaultOptions{}), ""))
+	defer faultySrv.Close()
+
+	for _, tc := range []struct {
+		name string
+		c    kvapi.Client
+	}{
+		{name: "faulty", c: kvapi.NewFaultyClient(plainClient{store}, kvapi.FaultOptions{})},
+		{name: "http", c: kvapi.NewHTTPClient(srv.URL, "", nil)},
+		{name: "httpFaulty", c: kvapi.NewHTTPClient(faultySrv.URL, "", nil)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, ok := tc.c.(kvapi.IdempotentClient)
+			require.True(t, ok)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			before, err := store.Get(&kvapi.GetRequest{Key: "counter"})
+			require.NoError(t, err)
+
+			require.NoError(t, retryupdate.UpdateValueContext(ctx, tc.c, "counter", increment, retryupdate.NoBackoff))
+
+			after, err := store.Get(&kvapi.GetRequest{Key: "counter"})
+			require.NoError(t, err)
+			n, _ := strconv.Atoi(before.Value)
+			require.Equal(t, strconv.Itoa(n+1), after.Value)
+		})
+	}
+}
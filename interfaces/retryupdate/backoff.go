@@ -0,0 +1,81 @@
+//go:build !solution
+
+package retryupdate
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff is a retry policy.
+type Backoff interface {
+	// Next returns the delay before the next attempt after failures failed attempts
+	// and elapsed time since the first one. It returns false to stop retrying.
+	Next(failures int, elapsed time.Duration) (delay time.Duration, ok bool)
+}
+
+// NoBackoff retries immediately and forever.
+var NoBackoff Backoff = noBackoff{}
+
+type noBackoff struct{}
+
+func (noBackoff) Next(int, time.Duration) (time.Duration, bool) {
+	return 0, true
+}
+
+// ExponentialBackoff multiplies the delay by Multiplier after every failed attempt.
+//
+// The zero value retries forever, starting with 10ms delay and doubling it up to 1s.
+type ExponentialBackoff struct {
+	// Initial is the delay after the first failure.
+	Initial time.Duration
+	// Max bounds the delay before jitter is applied.
+	Max time.Duration
+	// Multiplier is the growth factor of the delay, 2 if zero.
+	Multiplier float64
+	// Jitter is the fraction of the delay that is randomized: the delay d is
+	// replaced with a random delay from [d*(1-Jitter), d]. It must be in [0, 1].
+	Jitter float64
+
+	// MaxAttempts is the number of failed attempts after which retrying stops,
+	// zero means no limit.
+	MaxAttempts int
+	// MaxElapsed stops retrying once the next attempt would start after that time,
+	// zero means no limit.
+	MaxElapsed time.Duration
+}
+
+const (
+	defaultInitialBackoff = 10 * time.Millisecond
+	defaultMaxBackoff     = time.Second
+)
+
+func (b *ExponentialBackoff) Next(failures int, elapsed time.Duration) (time.Duration, bool) {
+	if b.MaxAttempts > 0 && failures >= b.MaxAttempts {
+		return 0, false
+	}
+
+	initial, maxDelay, multiplier := b.Initial, b.Max, b.Multiplier
+	if initial <= 0 {
+		initial = defaultInitialBackoff
+	}
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxBackoff
+	}
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	delay := float64(initial) * math.Pow(multiplier, float64(failures-1))
+	delay = min(delay, float64(maxDelay))
+	if b.Jitter > 0 {
+		delay -= delay * b.Jitter * rand.Float64()
+	}
+
+	d := time.Duration(delay)
+	if b.MaxElapsed > 0 && elapsed+d > b.MaxElapsed {
+		return 0, false
+	}
+	return d, true
+}
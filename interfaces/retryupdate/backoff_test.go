@@ -0,0 +1,146 @@
+package retryupdate_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/retryupdate"
+	"gitlab.com/slon/shad-go/retryupdate/kvapi"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	b := &retryupdate.ExponentialBackoff{
+		Initial:     time.Millisecond,
+		Max:         5 * time.Millisecond,
+		MaxAttempts: 5,
+	}
+
+	var delays []time.Duration
+	for failures := 1; ; failures++ {
+		delay, ok := b.Next(failures, 0)
+		if !ok {
+			break
+		}
+		delays = append(delays, delay)
+	}
+	require.Equal(t, []time.Duration{
+		time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond, 5 * time.Millisecond,
+	}, delays)
+}
+
+func TestExponentialBackoff_jitter(t *testing.T) {
+	b := &retryupdate.ExponentialBackoff{Initial: time.Second, Max: time.Second, Jitter: 0.5}
+
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		delay, ok := b.Next(1, 0)
+		require.True(t, ok)
+		require.GreaterOrEqual(t, delay, 500*time.Millisecond)
+		require.LessOrEqual(t, delay, time.Second)
+		seen[delay] = true
+	}
+	require.Greater(t, len(seen), 1)
+}
+
+func TestExponentialBackoff_maxElapsed(t *testing.T) {
+	b := &retryupdate.ExponentialBackoff{Initial: time.Second, MaxElapsed: 10 * time.Second}
+
+	_, ok := b.Next(1, 8*time.Second)
+	require.True(t, ok)
+
+	_, ok = b.Next(1, 9500*time.Millisecond)
+	require.False(t, ok)
+}
+
+func TestUpdateValueContext_maxAttempts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c := NewMockClient(ctrl)
+	gomock.InOrder(
+		c.EXPECT().
+			Get(&kvapi.GetRequest{Key: K0}).
+			Return(&kvapi.GetResponse{Value: V0, Version: UUID0}, nil),
+
+		c.EXPECT().
+			Set(SetRequest(K0, V1, UUID0)).
+			Return(nil, errSetTemporary).
+			Times(3),
+	)
+
+	backoff := &retryupdate.ExponentialBackoff{Initial: time.Millisecond, MaxAttempts: 3}
+	err := retryupdate.UpdateValueContext(context.Background(), c, K0, updateFn, backoff)
+
+	var retryErr *retryupdate.RetryError
+	require.ErrorAs(t, err, &retryErr)
+	require.Equal(t, 4, retryErr.Attempts)
+	require.Equal(t, errSetTemporary, retryErr.LastErr)
+	require.ErrorIs(t, err, retryupdate.ErrRetriesExhausted)
+
+	var errAPI *kvapi.APIError
+	require.ErrorAs(t, err, &errAPI)
+	require.Equal(t, "set", errAPI.Method)
+}
+
+func TestUpdateValueContext_recovers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c := NewMockClient(ctrl)
+	gomock.InOrder(
+		c.EXPECT().
+			Get(&kvapi.GetRequest{Key: K0}).
+			Return(nil, errGetTemporary).
+			Times(2),
+
+		c.EXPECT().
+			Get(&kvapi.GetRequest{Key: K0}).
+			Return(&kvapi.GetResponse{Value: V0, Version: UUID0}, nil),
+
+		c.EXPECT().
+			Set(SetRequest(K0, V1, UUID0)).
+			Return(&kvapi.SetResponse{}, nil),
+	)
+
+	backoff := &retryupdate.ExponentialBackoff{Initial: time.Millisecond, MaxAttempts: 3}
+	require.NoError(t, retryupdate.UpdateValueContext(context.Background(), c, K0, updateFn, backoff))
+}
+
+func TestUpdateValueContext_cancel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c := NewMockClient(ctrl)
+	c.EXPECT().
+		Get(&kvapi.GetRequest{Key: K0}).
+		DoAndReturn(func(*kvapi.GetRequest) (*kvapi.GetResponse, error) {
+			cancel()
+			return nil, errGetTemporary
+		})
+
+	backoff := &retryupdate.ExponentialBackoff{Initial: time.Hour}
+	err := retryupdate.UpdateValueContext(ctx, c, K0, updateFn, backoff)
+	require.ErrorIs(t, err, context.Canceled)
+	require.ErrorIs(t, err, errGetTemporary)
+
+	var retryErr *retryupdate.RetryError
+	require.ErrorAs(t, err, &retryErr)
+	require.Equal(t, 1, retryErr.Attempts)
+}
+
+func TestUpdateValueContext_cancelled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := retryupdate.UpdateValueContext(ctx, NewMockClient(ctrl), K0, updateFn, retryupdate.NoBackoff)
+	require.ErrorIs(t, err, context.Canceled)
+}
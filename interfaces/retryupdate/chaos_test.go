@@ -0,0 +1,80 @@
+package retryupdate_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/retryupdate"
+	"gitlab.com/slon/shad-go/retryupdate/kvapi"
+)
+
+func increment(oldValue *string) (string, error) {
+	if oldValue == nil {
+		return "1", nil
+	}
+
+	n, err := strconv.Atoi(*oldValue)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(n + 1), nil
+}
+
+func TestUpdateValue_chaos(t *testing.T) {
+	const increments = 50
+
+	for _, tc := range []struct {
+		name    string
+		workers int
+		opts    kvapi.FaultOptions
+	}{
+		{name: "errors", workers: 8, opts: kvapi.FaultOptions{ErrorRate: 0.3, Seed: 1}},
+		{name: "conflicts", workers: 8, opts: kvapi.FaultOptions{ErrorRate: 0.1, ConflictRate: 0.3, Seed: 2}},
+		{name: "latency", workers: 8, opts: kvapi.FaultOptions{ErrorRate: 0.1, MaxLatency: 100 * time.Microsecond, Seed: 3}},
+		// A lost Set is recognized only if no other writer overwrote it before the retry,
+		// so lost responses are tested with a single writer.
+		{name: "lostResponses", workers: 1, opts: kvapi.FaultOptions{ErrorRate: 0.2, LostResponseRate: 0.3, Seed: 4}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			workers, opts := tc.workers, tc.opts
+
+			store := kvapi.NewMemoryClient()
+			c := kvapi.NewFaultyClient(store, opts)
+
+			var wg sync.WaitGroup
+			for i := 0; i < workers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					backoff := &retryupdate.ExponentialBackoff{Initial: time.Microsecond, Max: time.Millisecond, Jitter: 1}
+					for j := 0; j < increments; j++ {
+						err := retryupdate.UpdateValueContext(context.Background(), c, "counter", increment, backoff)
+						if err != nil {
+							t.Errorf("UpdateValueContext: %v", err)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			rsp, err := store.Get(&kvapi.GetRequest{Key: "counter"})
+			require.NoError(t, err)
+			require.Equal(t, strconv.Itoa(workers*increments), rsp.Value)
+		})
+	}
+}
+
+func TestUpdateValue_chaosAuth(t *testing.T) {
+	c := kvapi.NewFaultyClient(kvapi.NewMemoryClient(), kvapi.FaultOptions{AuthErrorRate: 1})
+
+	err := retryupdate.UpdateValue(c, "counter", increment)
+	var errAuth *kvapi.AuthError
+	require.ErrorAs(t, err, &errAuth)
+}
@@ -0,0 +1,217 @@
+//go:build !solution
+
+package kvapi
+
+import (
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+var (
+	_ TxnClient        = (*FaultyClient)(nil)
+	_ IdempotentClient = (*FaultyClient)(nil)
+)
+
+var (
+	// ErrUnavailable is the temporary error injected by FaultyClient.
+	ErrUnavailable = errors.New("service unavailable")
+	// ErrNotSupported is returned by FaultyClient when the wrapped client does not implement the method,
+	// and by HTTPClient when the server does not serve it.
+	ErrNotSupported = errors.New("method is not supported")
+)
+
+// FaultOptions configures the faults injected by FaultyClient.
+// All rates are probabilities in [0, 1] applied to every call independently.
+type FaultOptions struct {
+	// ErrorRate is the rate of calls failing with ErrUnavailable without reaching the service.
+	ErrorRate float64
+	// LostResponseRate is the rate of calls that reach the service,
+	// but whose response is replaced with ErrUnavailable.
+	LostResponseRate float64
+	// ConflictRate is the rate of Set and Txn calls racing with a concurrent writer, which
+	// stores the same value under a new version right before the call.
+	ConflictRate float64
+	// AuthErrorRate is the rate of calls failing with *AuthError.
+	AuthErrorRate float64
+
+	// MaxLatency bounds the random delay added to every call.
+	MaxLatency time.Duration
+
+	// Seed makes the injected faults reproducible.
+	Seed uint64
+}
+
+// FaultyClient wraps a Client and injects errors, conflicts and latency.
+//
+// FaultyClient implements TxnClient and IdempotentClient, their methods fail
+// with ErrNotSupported unless the wrapped client implements them too.
+type FaultyClient struct {
+	client Client
+	opts   FaultOptions
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// roll returns true with the given probability.
+func (c *FaultyClient) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rand.Float64() < rate
+}
+
+func (c *FaultyClient) delay() {
+	if c.opts.MaxLatency <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	d := time.Duration(c.rand.Int64N(int64(c.opts.MaxLatency)))
+	c.mu.Unlock()
+
+	time.Sleep(d)
+}
+
+// fault returns the error to fail the call with before it reaches the service.
+func (c *FaultyClient) fault(method string) error {
+	c.delay()
+
+	switch {
+	case c.roll(c.opts.AuthErrorRate):
+		return &APIError{Method: method, Err: &AuthError{Msg: "injected auth error"}}
+	case c.roll(c.opts.ErrorRate):
+		return &APIError{Method: method, Err: ErrUnavailable}
+	}
+	return nil
+}
+
+func (c *FaultyClient) Get(req *GetRequest) (*GetResponse, error) {
+	if err := c.fault("get"); err != nil {
+		return nil, err
+	}
+
+	rsp, err := c.client.Get(req)
+	if err == nil && c.roll(c.opts.LostResponseRate) {
+		return nil, &APIError{Method: "get", Err: ErrUnavailable}
+	}
+	return rsp, err
+}
+
+func (c *FaultyClient) Set(req *SetRequest) (*SetResponse, error) {
+	if err := c.fault("set"); err != nil {
+		return nil, err
+	}
+
+	if c.roll(c.opts.ConflictRate) {
+		c.race(req.Key)
+	}
+
+	rsp, err := c.client.Set(req)
+	if err == nil && c.roll(c.opts.LostResponseRate) {
+		return nil, &APIError{Method: "set", Err: ErrUnavailable}
+	}
+	return rsp, err
+}
+
+func (c *FaultyClient) txnClient(method string) (TxnClient, error) {
+	tc, ok := c.client.(TxnClient)
+	if !ok {
+		return nil, &APIError{Method: method, Err: ErrNotSupported}
+	}
+	return tc, c.fault(method)
+}
+
+func (c *FaultyClient) Delete(req *DeleteRequest) (*DeleteResponse, error) {
+	tc, err := c.txnClient("delete")
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err := tc.Delete(req)
+	if err == nil && c.roll(c.opts.LostResponseRate) {
+		return nil, &APIError{Method: "delete", Err: ErrUnavailable}
+	}
+	return rsp, err
+}
+
+func (c *FaultyClient) List(req *ListRequest) (*ListResponse, error) {
+	tc, err := c.txnClient("list")
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err := tc.List(req)
+	if err == nil && c.roll(c.opts.LostResponseRate) {
+		return nil, &APIError{Method: "list", Err: ErrUnavailable}
+	}
+	return rsp, err
+}
+
+func (c *FaultyClient) Txn(req *TxnRequest) (*TxnResponse, error) {
+	tc, err := c.txnClient("txn")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(req.Compare) != 0 && c.roll(c.opts.ConflictRate) {
+		c.race(req.Compare[0].Key)
+	}
+
+	rsp, err := tc.Txn(req)
+	if err == nil && c.roll(c.opts.LostResponseRate) {
+		return nil, &APIError{Method: "txn", Err: ErrUnavailable}
+	}
+	return rsp, err
+}
+
+func (c *FaultyClient) SetIdempotent(req *IdempotentSetRequest) (*SetResponse, error) {
+	ic, ok := c.client.(IdempotentClient)
+	if !ok {
+		return nil, &APIError{Method: "set", Err: ErrNotSupported}
+	}
+	if err := c.fault("set"); err != nil {
+		return nil, err
+	}
+
+	if c.roll(c.opts.ConflictRate) {
+		c.race(req.Key)
+	}
+
+	rsp, err := ic.SetIdempotent(req)
+	if err == nil && c.roll(c.opts.LostResponseRate) {
+		return nil, &APIError{Method: "set", Err: ErrUnavailable}
+	}
+	return rsp, err
+}
+
+// race rewrites the current value of key under a new version.
+func (c *FaultyClient) race(key string) {
+	rsp, err := c.client.Get(&GetRequest{Key: key})
+	if err != nil {
+		return
+	}
+
+	_, _ = c.client.Set(&SetRequest{
+		Key:        key,
+		Value:      rsp.Value,
+		OldVersion: rsp.Version,
+		NewVersion: uuid.Must(uuid.NewV4()),
+	})
+}
+
+// NewFaultyClient returns a client injecting faults into calls to c.
+func NewFaultyClient(c Client, opts FaultOptions) *FaultyClient {
+	return &FaultyClient{
+		client: c,
+		opts:   opts,
+		rand:   rand.New(rand.NewPCG(opts.Seed, opts.Seed)),
+	}
+}
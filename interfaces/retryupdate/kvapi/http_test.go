@@ -0,0 +1,112 @@
+package kvapi_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/retryupdate"
+	"gitlab.com/slon/shad-go/retryupdate/kvapi"
+)
+
+const testToken = "secret"
+
+func newHTTPClient(t *testing.T, backend kvapi.Client) *kvapi.HTTPClient {
+	t.Helper()
+
+	srv := httptest.NewServer(kvapi.NewHandler(backend, testToken))
+	t.Cleanup(srv.Close)
+
+	return kvapi.NewHTTPClient(srv.URL, testToken, srv.Client())
+}
+
+func TestHTTP(t *testing.T) {
+	c := newHTTPClient(t, kvapi.NewMemoryClient())
+
+	_, err := c.Get(&kvapi.GetRequest{Key: "k"})
+	var errAPI *kvapi.APIError
+	require.ErrorAs(t, err, &errAPI)
+	require.Equal(t, "get", errAPI.Method)
+	require.ErrorIs(t, err, kvapi.ErrKeyNotFound)
+
+	v1, v2 := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+
+	_, err = c.Set(&kvapi.SetRequest{Key: "k", Value: "a", OldVersion: v1, NewVersion: v2})
+	require.ErrorAs(t, err, &errAPI)
+	require.Equal(t, "set", errAPI.Method)
+	require.ErrorIs(t, err, kvapi.ErrKeyNotFound)
+
+	_, err = c.Set(&kvapi.SetRequest{Key: "k", Value: "a", NewVersion: v1})
+	require.NoError(t, err)
+
+	rsp, err := c.Get(&kvapi.GetRequest{Key: "k"})
+	require.NoError(t, err)
+	require.Equal(t, &kvapi.GetResponse{Value: "a", Version: v1}, rsp)
+
+	_, err = c.Set(&kvapi.SetRequest{Key: "k", Value: "b", OldVersion: v2, NewVersion: uuid.Must(uuid.NewV4())})
+	var errConflict *kvapi.ConflictError
+	require.ErrorAs(t, err, &errConflict)
+	require.Equal(t, kvapi.ConflictError{ProvidedVersion: v2, ExpectedVersion: v1}, *errConflict)
+}
+
+func TestHTTP_auth(t *testing.T) {
+	srv := httptest.NewServer(kvapi.NewHandler(kvapi.NewMemoryClient(), testToken))
+	defer srv.Close()
+
+	for _, token := range []string{"", "wrong"} {
+		c := kvapi.NewHTTPClient(srv.URL, token, srv.Client())
+
+		_, err := c.Get(&kvapi.GetRequest{Key: "k"})
+		var errAuth *kvapi.AuthError
+		require.ErrorAs(t, err, &errAuth)
+	}
+
+	backend := kvapi.NewFaultyClient(kvapi.NewMemoryClient(), kvapi.FaultOptions{AuthErrorRate: 1})
+	_, err := newHTTPClient(t, backend).Get(&kvapi.GetRequest{Key: "k"})
+	var errAuth *kvapi.AuthError
+	require.ErrorAs(t, err, &errAuth)
+	require.Equal(t, "injected auth error", errAuth.Msg)
+}
+
+func TestHTTP_errors(t *testing.T) {
+	backend := kvapi.NewFaultyClient(kvapi.NewMemoryClient(), kvapi.FaultOptions{ErrorRate: 1})
+	_, err := newHTTPClient(t, backend).Get(&kvapi.GetRequest{Key: "k"})
+	require.ErrorIs(t, err, kvapi.ErrUnavailable)
+
+	srv := httptest.NewServer(kvapi.NewHandler(kvapi.NewMemoryClient(), ""))
+	rsp, err := srv.Client().Post(srv.URL+"/set", "application/json", strings.NewReader("{"))
+	require.NoError(t, err)
+	require.NoError(t, rsp.Body.Close())
+	require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+
+	srv.Close()
+
+	_, err = kvapi.NewHTTPClient(srv.URL, "", nil).Get(&kvapi.GetRequest{Key: "k"})
+	var errAPI *kvapi.APIError
+	require.ErrorAs(t, err, &errAPI, "transport errors are wrapped as well")
+}
+
+func TestHTTP_updateValue(t *testing.T) {
+	store := kvapi.NewMemoryClient()
+	c := newHTTPClient(t, kvapi.NewFaultyClient(store, kvapi.FaultOptions{ErrorRate: 0.3, Seed: 1}))
+
+	for i := 0; i < 20; i++ {
+		err := retryupdate.UpdateValue(c, "counter", func(oldValue *string) (string, error) {
+			if oldValue == nil {
+				return "1", nil
+			}
+			n, err := strconv.Atoi(*oldValue)
+			return strconv.Itoa(n + 1), err
+		})
+		require.NoError(t, err)
+	}
+
+	rsp, err := store.Get(&kvapi.GetRequest{Key: "counter"})
+	require.NoError(t, err)
+	require.Equal(t, "20", rsp.Value)
+}
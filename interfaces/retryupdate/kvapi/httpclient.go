@@ -0,0 +1,158 @@
+//go:build !solution
+
+package kvapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var (
+	_ TxnClient        = (*HTTPClient)(nil)
+	_ IdempotentClient = (*HTTPClient)(nil)
+)
+
+// HTTPClient is a TxnClient talking to a server created by NewHandler.
+type HTTPClient struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func (c *HTTPClient) Get(req *GetRequest) (*GetResponse, error) {
+	var rsp GetResponse
+	if err := c.call("get", pathGet, req, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+func (c *HTTPClient) Set(req *SetRequest) (*SetResponse, error) {
+	var rsp SetResponse
+	if err := c.call("set", pathSet, req, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+func (c *HTTPClient) SetIdempotent(req *IdempotentSetRequest) (*SetResponse, error) {
+	var rsp SetResponse
+	if err := c.call("set", pathSetIdempotent, req, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+func (c *HTTPClient) Delete(req *DeleteRequest) (*DeleteResponse, error) {
+	var rsp DeleteResponse
+	if err := c.call("delete", pathDelete, req, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+func (c *HTTPClient) List(req *ListRequest) (*ListResponse, error) {
+	var rsp ListResponse
+	if err := c.call("list", pathList, req, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+func (c *HTTPClient) Txn(req *TxnRequest) (*TxnResponse, error) {
+	var rsp TxnResponse
+	if err := c.call("txn", pathTxn, req, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+// call posts req to path and decodes the response into rsp.
+// Any error is wrapped into *APIError.
+func (c *HTTPClient) call(method, path string, req, rsp any) error {
+	if err := c.roundTrip(path, req, rsp); err != nil {
+		return &APIError{Method: method, Err: err}
+	}
+	return nil
+}
+
+func (c *HTTPClient) roundTrip(path string, req, rsp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	httpRsp, err := c.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpRsp.Body.Close()
+
+	if httpRsp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(httpRsp.Body).Decode(rsp); err != nil {
+			return fmt.Errorf("malformed response: %w", err)
+		}
+		return nil
+	}
+	return decodeError(httpRsp)
+}
+
+// decodeError restores the error of a failed call from its status code.
+func decodeError(httpRsp *http.Response) error {
+	var rsp errorResponse
+	body, err := io.ReadAll(io.LimitReader(httpRsp.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, &rsp); err != nil {
+		// Not a response of the service: the server does not route the method.
+		if httpRsp.StatusCode == http.StatusNotFound || httpRsp.StatusCode == http.StatusMethodNotAllowed {
+			return fmt.Errorf("%w: %s", ErrNotSupported, httpRsp.Status)
+		}
+		return fmt.Errorf("%s: %s", httpRsp.Status, strings.TrimSpace(string(body)))
+	}
+
+	switch httpRsp.StatusCode {
+	case http.StatusNotFound:
+		return ErrKeyNotFound
+	case http.StatusConflict:
+		if len(rsp.Conflicts) != 0 {
+			return &TxnConflictError{Conflicts: rsp.Conflicts}
+		}
+		return &ConflictError{ProvidedVersion: rsp.ProvidedVersion, ExpectedVersion: rsp.ExpectedVersion}
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &AuthError{Msg: rsp.Error}
+	case http.StatusServiceUnavailable:
+		return ErrUnavailable
+	case http.StatusNotImplemented:
+		return ErrNotSupported
+	}
+
+	if rsp.Error == "" {
+		return errors.New(httpRsp.Status)
+	}
+	return fmt.Errorf("%s: %s", httpRsp.Status, rsp.Error)
+}
+
+// NewHTTPClient returns a client of the server at baseURL, e.g. "http://localhost:8080".
+// Empty token disables authorization, nil client means http.DefaultClient.
+func NewHTTPClient(baseURL, token string, client *http.Client) *HTTPClient {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPClient{baseURL: strings.TrimSuffix(baseURL, "/"), token: token, client: client}
+}
@@ -0,0 +1,30 @@
+//go:build !solution
+
+package kvapi
+
+import "github.com/gofrs/uuid"
+
+// DedupWindow is the number of the latest idempotent requests remembered by MemoryClient.
+const DedupWindow = 10000
+
+type (
+	// IdempotentClient is implemented by stores that deduplicate retried writes.
+	IdempotentClient interface {
+		Client
+
+		// SetIdempotent is Set, except that a retry of an applied request succeeds
+		// instead of failing with a conflict or ErrKeyNotFound. Retries must reuse the
+		// RequestID and all other fields of the request.
+		//
+		// Wrappers and remote clients implement the method even if the store does not;
+		// then it fails with ErrNotSupported without reaching the store.
+		SetIdempotent(req *IdempotentSetRequest) (*SetResponse, error)
+	}
+
+	IdempotentSetRequest struct {
+		SetRequest
+
+		// RequestID identifies the request among its retries, it must not be zero.
+		RequestID uuid.UUID
+	}
+)
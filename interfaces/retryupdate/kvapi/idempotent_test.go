@@ -0,0 +1,111 @@
+package kvapi_test
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/retryupdate/kvapi"
+)
+
+func testSetIdempotent(t *testing.T, store kvapi.Client, c kvapi.IdempotentClient) {
+	v1, v2 := newVersion(), newVersion()
+	id := newVersion()
+
+	req := &kvapi.IdempotentSetRequest{
+		SetRequest: kvapi.SetRequest{Key: "k", Value: "a", NewVersion: v1},
+		RequestID:  id,
+	}
+	_, err := c.SetIdempotent(req)
+	require.NoError(t, err)
+
+	// A retry of an applied request succeeds even though the key has a new version.
+	_, err = c.SetIdempotent(req)
+	require.NoError(t, err)
+
+	_, err = store.Set(&kvapi.SetRequest{Key: "k", Value: "b", OldVersion: v1, NewVersion: v2})
+	require.NoError(t, err)
+
+	_, err = c.SetIdempotent(req)
+	require.NoError(t, err)
+
+	rsp, err := store.Get(&kvapi.GetRequest{Key: "k"})
+	require.NoError(t, err)
+	require.Equal(t, &kvapi.GetResponse{Value: "b", Version: v2}, rsp)
+
+	// A new request is checked as usual.
+	_, err = c.SetIdempotent(&kvapi.IdempotentSetRequest{
+		SetRequest: kvapi.SetRequest{Key: "k", Value: "c", OldVersion: v1, NewVersion: newVersion()},
+		RequestID:  newVersion(),
+	})
+	var errConflict *kvapi.ConflictError
+	require.ErrorAs(t, err, &errConflict)
+	require.Equal(t, v2, errConflict.ExpectedVersion)
+
+	// The request id must not be reused for another write.
+	_, err = c.SetIdempotent(&kvapi.IdempotentSetRequest{
+		SetRequest: kvapi.SetRequest{Key: "k", Value: "c", OldVersion: v2, NewVersion: newVersion()},
+		RequestID:  id,
+	})
+	require.Error(t, err)
+	require.NotErrorIs(t, err, kvapi.ErrKeyNotFound)
+
+	_, err = c.SetIdempotent(&kvapi.IdempotentSetRequest{
+		SetRequest: kvapi.SetRequest{Key: "k", Value: "c", OldVersion: v2, NewVersion: newVersion()},
+	})
+	require.Error(t, err)
+}
+
+func TestSetIdempotent(t *testing.T) {
+	c := kvapi.NewMemoryClient()
+	testSetIdempotent(t, c, c)
+}
+
+func TestSetIdempotent_http(t *testing.T) {
+	store := kvapi.NewMemoryClient()
+	testSetIdempotent(t, store, newHTTPClient(t, store))
+}
+
+func TestSetIdempotent_dedupWindow(t *testing.T) {
+	c := kvapi.NewMemoryClient()
+
+	first := &kvapi.IdempotentSetRequest{
+		SetRequest: kvapi.SetRequest{Key: "k", Value: "0", NewVersion: newVersion()},
+		RequestID:  newVersion(),
+	}
+	_, err := c.SetIdempotent(first)
+	require.NoError(t, err)
+
+	version := first.NewVersion
+	for i := 0; i < kvapi.DedupWindow; i++ {
+		next := newVersion()
+		_, err := c.SetIdempotent(&kvapi.IdempotentSetRequest{
+			SetRequest: kvapi.SetRequest{Key: "k", Value: "v", OldVersion: version, NewVersion: next},
+			RequestID:  newVersion(),
+		})
+		require.NoError(t, err)
+		version = next
+	}
+
+	// The first request fell out of the window and is checked as a new one.
+	_, err = c.SetIdempotent(first)
+	var errConflict *kvapi.ConflictError
+	require.ErrorAs(t, err, &errConflict)
+	require.Equal(t, version, errConflict.ExpectedVersion)
+}
+
+func TestFaultyClient_setIdempotent(t *testing.T) {
+	store := kvapi.NewMemoryClient()
+	c := kvapi.NewFaultyClient(store, kvapi.FaultOptions{LostResponseRate: 1})
+
+	req := &kvapi.IdempotentSetRequest{
+		SetRequest: kvapi.SetRequest{Key: "k", Value: "a", NewVersion: uuid.Must(uuid.NewV4())},
+		RequestID:  uuid.Must(uuid.NewV4()),
+	}
+	_, err := c.SetIdempotent(req)
+	require.ErrorIs(t, err, kvapi.ErrUnavailable)
+
+	_, err = store.SetIdempotent(req)
+	require.NoError(t, err)
+}
@@ -0,0 +1,326 @@
+//go:build !solution
+
+package kvapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gofrs/uuid"
+)
+
+var (
+	_ TxnClient   = (*MemoryClient)(nil)
+	_ WatchClient = (*MemoryClient)(nil)
+
+	_ IdempotentClient = (*MemoryClient)(nil)
+)
+
+var (
+	errZeroVersion   = errors.New("new version must not be zero")
+	errInvalidLimit  = errors.New("invalid list limit")
+	errInvalidOp     = errors.New("invalid txn op")
+	errInvalidBuffer = errors.New("invalid watch buffer")
+
+	errZeroRequestID   = errors.New("request id must not be zero")
+	errRequestIDReused = errors.New("request id was used for another request")
+)
+
+type memoryEntry struct {
+	value   string
+	version uuid.UUID
+}
+
+// MemoryClient is an in-memory implementation of the service.
+//
+// It follows the same compare-and-set semantics as the real service and returns
+// the same errors, all wrapped into *APIError.
+type MemoryClient struct {
+	mu       sync.Mutex
+	entries  map[string]memoryEntry
+	revision int64
+	watches  map[*memoryWatch]struct{}
+
+	// applied remembers the last DedupWindow applied idempotent requests.
+	applied      map[uuid.UUID]appliedRequest
+	appliedOrder []uuid.UUID
+}
+
+type appliedRequest struct {
+	key     string
+	version uuid.UUID
+}
+
+type memoryWatch struct {
+	req   WatchRequest
+	watch *Watch
+	done  chan struct{}
+}
+
+// put stores the value and notifies watches. c.mu must be held.
+func (c *MemoryClient) put(key, value string, version uuid.UUID) {
+	old := c.entries[key]
+	c.entries[key] = memoryEntry{value: value, version: version}
+	c.notify(Event{Type: EventPut, Key: key, Value: value, OldVersion: old.version, NewVersion: version})
+}
+
+// remove deletes the key and notifies watches. c.mu must be held.
+func (c *MemoryClient) remove(key string) {
+	old, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	delete(c.entries, key)
+	c.notify(Event{Type: EventDelete, Key: key, OldVersion: old.version})
+}
+
+// notify sends ev to the matching watches. c.mu must be held.
+//
+// Writers never wait for watches: a watch whose buffer is full is stopped with ErrWatchOverflow.
+func (c *MemoryClient) notify(ev Event) {
+	c.revision++
+	ev.Revision = c.revision
+
+	for w := range c.watches {
+		if !w.req.matches(ev.Key) {
+			continue
+		}
+
+		select {
+		case w.watch.events <- ev:
+		default:
+			c.stopWatch(w, ErrWatchOverflow)
+		}
+	}
+}
+
+// stopWatch ends the watch with err. c.mu must be held.
+func (c *MemoryClient) stopWatch(w *memoryWatch, err error) {
+	if _, ok := c.watches[w]; !ok {
+		return
+	}
+
+	delete(c.watches, w)
+	w.watch.err = err
+	close(w.watch.events)
+	close(w.done)
+}
+
+func (c *MemoryClient) Get(req *GetRequest) (*GetResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[req.Key]
+	if !ok {
+		return nil, &APIError{Method: "get", Err: ErrKeyNotFound}
+	}
+	return &GetResponse{Value: e.value, Version: e.version}, nil
+}
+
+func (c *MemoryClient) Set(req *SetRequest) (*SetResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.set(req); err != nil {
+		return nil, err
+	}
+	return &SetResponse{}, nil
+}
+
+// set applies req. c.mu must be held.
+func (c *MemoryClient) set(req *SetRequest) error {
+	if req.NewVersion == uuid.Nil {
+		return &APIError{Method: "set", Err: errZeroVersion}
+	}
+
+	e, ok := c.entries[req.Key]
+	switch {
+	case !ok && req.OldVersion != uuid.Nil:
+		return &APIError{Method: "set", Err: ErrKeyNotFound}
+	case ok && e.version != req.OldVersion:
+		return &APIError{Method: "set", Err: &ConflictError{
+			ProvidedVersion: req.OldVersion,
+			ExpectedVersion: e.version,
+		}}
+	}
+
+	c.put(req.Key, req.Value, req.NewVersion)
+	return nil
+}
+
+func (c *MemoryClient) SetIdempotent(req *IdempotentSetRequest) (*SetResponse, error) {
+	if req.RequestID == uuid.Nil {
+		return nil, &APIError{Method: "set", Err: errZeroRequestID}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if applied, ok := c.applied[req.RequestID]; ok {
+		if applied != (appliedRequest{key: req.Key, version: req.NewVersion}) {
+			return nil, &APIError{Method: "set", Err: errRequestIDReused}
+		}
+		return &SetResponse{}, nil
+	}
+
+	if err := c.set(&req.SetRequest); err != nil {
+		return nil, err
+	}
+
+	if len(c.appliedOrder) == DedupWindow {
+		delete(c.applied, c.appliedOrder[0])
+		c.appliedOrder = c.appliedOrder[1:]
+	}
+	c.applied[req.RequestID] = appliedRequest{key: req.Key, version: req.NewVersion}
+	c.appliedOrder = append(c.appliedOrder, req.RequestID)
+	return &SetResponse{}, nil
+}
+
+func (c *MemoryClient) Delete(req *DeleteRequest) (*DeleteResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[req.Key]
+	switch {
+	case !ok:
+		return nil, &APIError{Method: "delete", Err: ErrKeyNotFound}
+	case e.version != req.OldVersion:
+		return nil, &APIError{Method: "delete", Err: &ConflictError{
+			ProvidedVersion: req.OldVersion,
+			ExpectedVersion: e.version,
+		}}
+	}
+
+	c.remove(req.Key)
+	return &DeleteResponse{}, nil
+}
+
+func (c *MemoryClient) List(req *ListRequest) (*ListResponse, error) {
+	limit := req.Limit
+	if limit == 0 {
+		limit = DefaultListLimit
+	}
+	if limit < 0 || limit > MaxListLimit {
+		return nil, &APIError{Method: "list", Err: errInvalidLimit}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var keys []string
+	for key := range c.entries {
+		if strings.HasPrefix(key, req.Prefix) && key > req.After {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	rsp := &ListResponse{}
+	if len(keys) > limit {
+		keys = keys[:limit]
+		rsp.NextAfter = keys[limit-1]
+	}
+
+	rsp.Entries = make([]Entry, len(keys))
+	for i, key := range keys {
+		e := c.entries[key]
+		rsp.Entries[i] = Entry{Key: key, Value: e.value, Version: e.version}
+	}
+	return rsp, nil
+}
+
+func (c *MemoryClient) Txn(req *TxnRequest) (*TxnResponse, error) {
+	for _, op := range req.Ops {
+		if op.Type == OpPut && op.NewVersion == uuid.Nil {
+			return nil, &APIError{Method: "txn", Err: errZeroVersion}
+		}
+		if op.Type != OpPut && op.Type != OpDelete {
+			return nil, &APIError{Method: "txn", Err: fmt.Errorf("%w: %v", errInvalidOp, op.Type)}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var conflict TxnConflictError
+	for _, cmp := range req.Compare {
+		if version := c.entries[cmp.Key].version; version != cmp.Version {
+			conflict.Conflicts = append(conflict.Conflicts, KeyConflict{
+				Key:           cmp.Key,
+				ConflictError: ConflictError{ProvidedVersion: cmp.Version, ExpectedVersion: version},
+			})
+		}
+	}
+	if len(conflict.Conflicts) != 0 {
+		return nil, &APIError{Method: "txn", Err: &conflict}
+	}
+
+	for _, op := range req.Ops {
+		switch op.Type {
+		case OpPut:
+			c.put(op.Key, op.Value, op.NewVersion)
+		case OpDelete:
+			c.remove(op.Key)
+		}
+	}
+	return &TxnResponse{}, nil
+}
+
+func (c *MemoryClient) Watch(ctx context.Context, req *WatchRequest) (*Watch, error) {
+	buffer := req.Buffer
+	if buffer == 0 {
+		buffer = DefaultWatchBuffer
+	}
+	if buffer < 0 {
+		return nil, &APIError{Method: "watch", Err: errInvalidBuffer}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	w := &memoryWatch{
+		req:   *req,
+		watch: &Watch{events: make(chan Event, buffer)},
+		done:  make(chan struct{}),
+	}
+	w.watch.stop = func(err error) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.stopWatch(w, err)
+	}
+
+	c.mu.Lock()
+	c.watches[w] = struct{}{}
+	if !req.Prefix {
+		if e := c.entries[req.Key]; e.version != req.FromVersion {
+			ev := Event{Type: EventPut, Key: req.Key, Value: e.value, OldVersion: req.FromVersion, NewVersion: e.version, Revision: c.revision}
+			if e.version == uuid.Nil {
+				ev.Type = EventDelete
+			}
+			w.watch.events <- ev
+		}
+	}
+	c.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.watch.stop(ctx.Err())
+		case <-w.done:
+		}
+	}()
+	return w.watch, nil
+}
+
+// NewMemoryClient returns an empty in-memory store.
+func NewMemoryClient() *MemoryClient {
+	return &MemoryClient{
+		entries: make(map[string]memoryEntry),
+		watches: make(map[*memoryWatch]struct{}),
+		applied: make(map[uuid.UUID]appliedRequest),
+	}
+}
@@ -0,0 +1,109 @@
+package kvapi_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/retryupdate/kvapi"
+)
+
+func TestMemoryClient(t *testing.T) {
+	c := kvapi.NewMemoryClient()
+
+	_, err := c.Get(&kvapi.GetRequest{Key: "k"})
+	require.ErrorIs(t, err, kvapi.ErrKeyNotFound)
+
+	v1, v2 := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+
+	_, err = c.Set(&kvapi.SetRequest{Key: "k", Value: "a", OldVersion: v1, NewVersion: v2})
+	require.ErrorIs(t, err, kvapi.ErrKeyNotFound)
+
+	_, err = c.Set(&kvapi.SetRequest{Key: "k", Value: "a", NewVersion: v1})
+	require.NoError(t, err)
+
+	rsp, err := c.Get(&kvapi.GetRequest{Key: "k"})
+	require.NoError(t, err)
+	require.Equal(t, &kvapi.GetResponse{Value: "a", Version: v1}, rsp)
+
+	_, err = c.Set(&kvapi.SetRequest{Key: "k", Value: "b", NewVersion: v2})
+	var errConflict *kvapi.ConflictError
+	require.ErrorAs(t, err, &errConflict)
+	require.Equal(t, kvapi.ConflictError{ProvidedVersion: uuid.Nil, ExpectedVersion: v1}, *errConflict)
+
+	_, err = c.Set(&kvapi.SetRequest{Key: "k", Value: "b", OldVersion: v1, NewVersion: v2})
+	require.NoError(t, err)
+
+	_, err = c.Set(&kvapi.SetRequest{Key: "k", Value: "c", OldVersion: v1, NewVersion: uuid.Must(uuid.NewV4())})
+	require.ErrorAs(t, err, &errConflict)
+	require.Equal(t, v2, errConflict.ExpectedVersion)
+
+	var errAPI *kvapi.APIError
+	_, err = c.Set(&kvapi.SetRequest{Key: "k", Value: "c", OldVersion: v2})
+	require.ErrorAs(t, err, &errAPI)
+	require.Equal(t, "set", errAPI.Method)
+
+	rsp, err = c.Get(&kvapi.GetRequest{Key: "k"})
+	require.NoError(t, err)
+	require.Equal(t, &kvapi.GetResponse{Value: "b", Version: v2}, rsp)
+}
+
+func TestFaultyClient(t *testing.T) {
+	store := kvapi.NewMemoryClient()
+	c := kvapi.NewFaultyClient(store, kvapi.FaultOptions{
+		ErrorRate:     0.2,
+		AuthErrorRate: 0.1,
+		Seed:          1,
+	})
+
+	var unavailable, authErrors int
+	for i := 0; i < 1000; i++ {
+		_, err := c.Get(&kvapi.GetRequest{Key: "k"})
+
+		var errAuth *kvapi.AuthError
+		switch {
+		case errors.As(err, &errAuth):
+			authErrors++
+		case errors.Is(err, kvapi.ErrUnavailable):
+			unavailable++
+		default:
+			require.ErrorIs(t, err, kvapi.ErrKeyNotFound)
+		}
+	}
+
+	require.InDelta(t, 100, authErrors, 40)
+	require.InDelta(t, 180, unavailable, 50)
+}
+
+func TestFaultyClient_lostResponse(t *testing.T) {
+	store := kvapi.NewMemoryClient()
+	c := kvapi.NewFaultyClient(store, kvapi.FaultOptions{LostResponseRate: 1})
+
+	version := uuid.Must(uuid.NewV4())
+	_, err := c.Set(&kvapi.SetRequest{Key: "k", Value: "a", NewVersion: version})
+	require.ErrorIs(t, err, kvapi.ErrUnavailable)
+
+	rsp, err := store.Get(&kvapi.GetRequest{Key: "k"})
+	require.NoError(t, err)
+	require.Equal(t, version, rsp.Version, "the write is applied despite the error")
+}
+
+func TestFaultyClient_conflict(t *testing.T) {
+	store := kvapi.NewMemoryClient()
+	c := kvapi.NewFaultyClient(store, kvapi.FaultOptions{ConflictRate: 1})
+
+	version := uuid.Must(uuid.NewV4())
+	_, err := store.Set(&kvapi.SetRequest{Key: "k", Value: "a", NewVersion: version})
+	require.NoError(t, err)
+
+	_, err = c.Set(&kvapi.SetRequest{Key: "k", Value: "b", OldVersion: version, NewVersion: uuid.Must(uuid.NewV4())})
+	var errConflict *kvapi.ConflictError
+	require.ErrorAs(t, err, &errConflict)
+	require.Equal(t, version, errConflict.ProvidedVersion)
+
+	rsp, err := store.Get(&kvapi.GetRequest{Key: "k"})
+	require.NoError(t, err)
+	require.Equal(t, "a", rsp.Value, "the concurrent writer keeps the value")
+}
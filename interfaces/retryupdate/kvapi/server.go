@@ -0,0 +1,141 @@
+//go:build !solution
+
+package kvapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gofrs/uuid"
+)
+
+// The HTTP protocol: every method is a POST of the JSON-encoded request to /<method>.
+// A successful call responds with 200 and the JSON-encoded response, a failed one
+// with errorResponse and a status code telling the kind of the error:
+//
+//	404 ErrKeyNotFound
+//	409 *ConflictError, or *TxnConflictError if conflicts are listed
+//	401 *AuthError
+//	503 ErrUnavailable
+const (
+	pathGet    = "/get"
+	pathSet    = "/set"
+	pathDelete = "/delete"
+	pathList   = "/list"
+	pathTxn    = "/txn"
+
+	pathSetIdempotent = "/set_idempotent"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+
+	ProvidedVersion uuid.UUID     `json:"provided_version"`
+	ExpectedVersion uuid.UUID     `json:"expected_version"`
+	Conflicts       []KeyConflict `json:"conflicts,omitempty"`
+}
+
+type server struct {
+	backend Client
+	token   string
+}
+
+func (s *server) authorize(r *http.Request) error {
+	if s.token == "" {
+		return nil
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return &AuthError{Msg: "missing token"}
+	}
+	if token != s.token {
+		return &AuthError{Msg: "invalid token"}
+	}
+	return nil
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var (
+		errTxnConflict *TxnConflictError
+		errConflict    *ConflictError
+		errAuth        *AuthError
+	)
+
+	status := http.StatusInternalServerError
+	rsp := errorResponse{Error: err.Error()}
+
+	switch {
+	case errors.Is(err, ErrKeyNotFound):
+		status = http.StatusNotFound
+	case errors.As(err, &errTxnConflict):
+		status = http.StatusConflict
+		rsp.Conflicts = errTxnConflict.Conflicts
+	case errors.As(err, &errConflict):
+		status = http.StatusConflict
+		rsp.ProvidedVersion = errConflict.ProvidedVersion
+		rsp.ExpectedVersion = errConflict.ExpectedVersion
+	case errors.As(err, &errAuth):
+		status = http.StatusUnauthorized
+		rsp.Error = errAuth.Msg
+	case errors.Is(err, ErrUnavailable):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, ErrNotSupported):
+		status = http.StatusNotImplemented
+	}
+
+	writeJSON(w, status, rsp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// handle decodes the request of type Req, calls the backend and encodes the response.
+func handle[Req, Rsp any](s *server, call func(*Req) (*Rsp, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.authorize(r); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		var req Req
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "malformed request: " + err.Error()})
+			return
+		}
+
+		rsp, err := call(&req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rsp)
+	}
+}
+
+// NewHandler returns an HTTP handler serving backend.
+// Delete, List and Txn are served if backend is a TxnClient,
+// SetIdempotent if it is an IdempotentClient.
+//
+// If token is not empty, requests must carry it in the "Authorization: Bearer" header.
+func NewHandler(backend Client, token string) http.Handler {
+	s := &server{backend: backend, token: token}
+
+	mux := http.NewServeMux()
+	mux.Handle("POST "+pathGet, handle(s, backend.Get))
+	mux.Handle("POST "+pathSet, handle(s, backend.Set))
+	if tc, ok := backend.(TxnClient); ok {
+		mux.Handle("POST "+pathDelete, handle(s, tc.Delete))
+		mux.Handle("POST "+pathList, handle(s, tc.List))
+		mux.Handle("POST "+pathTxn, handle(s, tc.Txn))
+	}
+	if ic, ok := backend.(IdempotentClient); ok {
+		mux.Handle("POST "+pathSetIdempotent, handle(s, ic.SetIdempotent))
+	}
+	return mux
+}
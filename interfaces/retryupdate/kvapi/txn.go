@@ -0,0 +1,143 @@
+//go:build !solution
+
+package kvapi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofrs/uuid"
+)
+
+var _ error = (*TxnConflictError)(nil)
+
+type (
+	// TxnClient extends Client with deletes, listing and multi-key transactions.
+	TxnClient interface {
+		Client
+
+		// Delete key.
+		Delete(req *DeleteRequest) (*DeleteResponse, error)
+
+		// List keys starting with prefix in lexicographical order.
+		List(req *ListRequest) (*ListResponse, error)
+
+		// Txn atomically applies Ops if all Compare conditions hold.
+		Txn(req *TxnRequest) (*TxnResponse, error)
+	}
+
+	DeleteRequest struct {
+		Key string
+
+		// OldVersion must specify uuid of currently stored value.
+		OldVersion uuid.UUID
+	}
+
+	DeleteResponse struct{}
+
+	ListRequest struct {
+		Prefix string
+
+		// After is the key after which the listing starts, the NextAfter of the previous page.
+		After string
+
+		// Limit is the maximal number of entries returned, DefaultListLimit if zero.
+		Limit int
+	}
+
+	ListResponse struct {
+		Entries []Entry
+
+		// NextAfter is the After of the next page, empty if this is the last page.
+		NextAfter string
+	}
+
+	Entry struct {
+		Key, Value string
+		Version    uuid.UUID
+	}
+
+	TxnRequest struct {
+		Compare []Compare
+		Ops     []Op
+	}
+
+	TxnResponse struct{}
+
+	// Compare holds if key is stored with Version, or is missing if Version is zero.
+	Compare struct {
+		Key     string
+		Version uuid.UUID
+	}
+
+	// Op is a put or a delete of a key. Ops are applied in order.
+	Op struct {
+		Type       OpType
+		Key, Value string
+
+		// NewVersion is the version of the value stored by a put.
+		NewVersion uuid.UUID
+	}
+
+	OpType int
+
+	// TxnConflictError lists the Compare conditions that failed.
+	TxnConflictError struct {
+		Conflicts []KeyConflict
+	}
+
+	KeyConflict struct {
+		Key string
+
+		ConflictError
+	}
+)
+
+const (
+	OpPut OpType = iota
+	OpDelete
+)
+
+// DefaultListLimit is the page size of List when ListRequest.Limit is zero.
+const DefaultListLimit = 100
+
+// MaxListLimit bounds ListRequest.Limit.
+const MaxListLimit = 1000
+
+// Put returns an Op storing value under key.
+func Put(key, value string, newVersion uuid.UUID) Op {
+	return Op{Type: OpPut, Key: key, Value: value, NewVersion: newVersion}
+}
+
+// Delete returns an Op deleting key.
+func Delete(key string) Op {
+	return Op{Type: OpDelete, Key: key}
+}
+
+func (t OpType) String() string {
+	switch t {
+	case OpPut:
+		return "put"
+	case OpDelete:
+		return "delete"
+	default:
+		return fmt.Sprintf("OpType(%d)", int(t))
+	}
+}
+
+func (a *TxnConflictError) Error() string {
+	keys := make([]string, len(a.Conflicts))
+	for i, c := range a.Conflicts {
+		keys[i] = fmt.Sprintf("%q (expected_version=%v, provided_version=%v)", c.Key, c.ExpectedVersion, c.ProvidedVersion)
+	}
+	return "api: txn conflict: " + strings.Join(keys, ", ")
+}
+
+// Unwrap returns a *ConflictError for every conflicting key.
+func (a *TxnConflictError) Unwrap() []error {
+	errs := make([]error, len(a.Conflicts))
+	for i := range a.Conflicts {
+		errs[i] = &a.Conflicts[i].ConflictError
+	}
+	return errs
+}
@@ -0,0 +1,145 @@
+package kvapi_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/retryupdate/kvapi"
+)
+
+func newVersion() uuid.UUID {
+	return uuid.Must(uuid.NewV4())
+}
+
+func TestDelete(t *testing.T) {
+	c := kvapi.NewMemoryClient()
+
+	_, err := c.Delete(&kvapi.DeleteRequest{Key: "k"})
+	require.ErrorIs(t, err, kvapi.ErrKeyNotFound)
+
+	version := newVersion()
+	_, err = c.Set(&kvapi.SetRequest{Key: "k", Value: "a", NewVersion: version})
+	require.NoError(t, err)
+
+	_, err = c.Delete(&kvapi.DeleteRequest{Key: "k", OldVersion: newVersion()})
+	var errConflict *kvapi.ConflictError
+	require.ErrorAs(t, err, &errConflict)
+	require.Equal(t, version, errConflict.ExpectedVersion)
+
+	_, err = c.Delete(&kvapi.DeleteRequest{Key: "k", OldVersion: version})
+	require.NoError(t, err)
+
+	_, err = c.Get(&kvapi.GetRequest{Key: "k"})
+	require.ErrorIs(t, err, kvapi.ErrKeyNotFound)
+}
+
+func listAll(t *testing.T, c kvapi.TxnClient, prefix string, limit int) (keys []string, pages int) {
+	t.Helper()
+
+	req := &kvapi.ListRequest{Prefix: prefix, Limit: limit}
+	for {
+		rsp, err := c.List(req)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(rsp.Entries), limit)
+
+		pages++
+		for _, e := range rsp.Entries {
+			keys = append(keys, e.Key)
+		}
+
+		if rsp.NextAfter == "" {
+			return keys, pages
+		}
+		req.After = rsp.NextAfter
+	}
+}
+
+func testList(t *testing.T, c kvapi.TxnClient) {
+	var want []string
+	for i := 0; i < 25; i++ {
+		key := fmt.Sprintf("dir/%02d", i)
+		want = append(want, key)
+		_, err := c.Set(&kvapi.SetRequest{Key: key, Value: "v", NewVersion: newVersion()})
+		require.NoError(t, err)
+	}
+	for _, key := range []string{"di", "dir", "dis/00", "other"} {
+		_, err := c.Set(&kvapi.SetRequest{Key: key, Value: "v", NewVersion: newVersion()})
+		require.NoError(t, err)
+	}
+
+	keys, pages := listAll(t, c, "dir/", 10)
+	require.Equal(t, want, keys)
+	require.Equal(t, 3, pages)
+
+	keys, pages = listAll(t, c, "dir/", 25)
+	require.Equal(t, want, keys)
+	require.Equal(t, 1, pages)
+
+	keys, _ = listAll(t, c, "", 7)
+	require.Len(t, keys, 29)
+
+	_, err := c.List(&kvapi.ListRequest{Limit: kvapi.MaxListLimit + 1})
+	var errAPI *kvapi.APIError
+	require.ErrorAs(t, err, &errAPI)
+}
+
+func testTxn(t *testing.T, c kvapi.TxnClient) {
+	va := newVersion()
+	_, err := c.Set(&kvapi.SetRequest{Key: "a", Value: "1", NewVersion: va})
+	require.NoError(t, err)
+
+	vb := newVersion()
+	_, err = c.Txn(&kvapi.TxnRequest{
+		Compare: []kvapi.Compare{{Key: "a", Version: newVersion()}, {Key: "b"}, {Key: "c", Version: newVersion()}},
+		Ops:     []kvapi.Op{kvapi.Put("b", "2", vb)},
+	})
+	var errTxn *kvapi.TxnConflictError
+	require.ErrorAs(t, err, &errTxn)
+	require.Len(t, errTxn.Conflicts, 2)
+	require.Equal(t, "a", errTxn.Conflicts[0].Key)
+	require.Equal(t, va, errTxn.Conflicts[0].ExpectedVersion)
+	require.Equal(t, "c", errTxn.Conflicts[1].Key)
+	require.Equal(t, uuid.Nil, errTxn.Conflicts[1].ExpectedVersion)
+
+	var errConflict *kvapi.ConflictError
+	require.ErrorAs(t, err, &errConflict, "txn conflicts unwrap to ConflictError")
+
+	_, err = c.Get(&kvapi.GetRequest{Key: "b"})
+	require.ErrorIs(t, err, kvapi.ErrKeyNotFound, "failed txn must not be applied")
+
+	_, err = c.Txn(&kvapi.TxnRequest{
+		Compare: []kvapi.Compare{{Key: "a", Version: va}, {Key: "b"}},
+		Ops:     []kvapi.Op{kvapi.Put("b", "2", vb), kvapi.Delete("a")},
+	})
+	require.NoError(t, err)
+
+	_, err = c.Get(&kvapi.GetRequest{Key: "a"})
+	require.ErrorIs(t, err, kvapi.ErrKeyNotFound)
+
+	rsp, err := c.Get(&kvapi.GetRequest{Key: "b"})
+	require.NoError(t, err)
+	require.Equal(t, &kvapi.GetResponse{Value: "2", Version: vb}, rsp)
+
+	_, err = c.Txn(&kvapi.TxnRequest{Ops: []kvapi.Op{kvapi.Put("b", "3", uuid.Nil)}})
+	require.Error(t, err)
+}
+
+func TestList(t *testing.T) {
+	t.Run("memory", func(t *testing.T) { testList(t, kvapi.NewMemoryClient()) })
+	t.Run("http", func(t *testing.T) { testList(t, newHTTPClient(t, kvapi.NewMemoryClient())) })
+}
+
+func TestTxn(t *testing.T) {
+	t.Run("memory", func(t *testing.T) { testTxn(t, kvapi.NewMemoryClient()) })
+	t.Run("http", func(t *testing.T) { testTxn(t, newHTTPClient(t, kvapi.NewMemoryClient())) })
+}
+
+func TestFaultyClient_notSupported(t *testing.T) {
+	c := kvapi.NewFaultyClient(struct{ kvapi.Client }{kvapi.NewMemoryClient()}, kvapi.FaultOptions{})
+
+	_, err := c.Txn(&kvapi.TxnRequest{})
+	require.ErrorIs(t, err, kvapi.ErrNotSupported)
+}
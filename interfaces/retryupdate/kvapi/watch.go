@@ -0,0 +1,106 @@
+//go:build !solution
+
+package kvapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofrs/uuid"
+)
+
+var (
+	// ErrWatchOverflow ends a watch whose consumer fell behind. Events were lost,
+	// so the consumer must treat all watched keys as changed.
+	ErrWatchOverflow = errors.New("watch overflow")
+	// ErrWatchClosed ends a watch stopped by Close.
+	ErrWatchClosed = errors.New("watch closed")
+)
+
+// DefaultWatchBuffer is the number of events buffered for a watch if WatchRequest.Buffer is zero.
+const DefaultWatchBuffer = 64
+
+type (
+	// WatchClient is implemented by stores that can report changes of keys.
+	WatchClient interface {
+		// Watch streams changes of the watched keys until ctx is done or the watch is closed.
+		Watch(ctx context.Context, req *WatchRequest) (*Watch, error)
+	}
+
+	WatchRequest struct {
+		// Key is the watched key, or a key prefix if Prefix is set.
+		Key    string
+		Prefix bool
+
+		// FromVersion is the version of Key known to the caller. If the key is stored under
+		// another version when the watch starts, the missed change is reported as the first event.
+		// FromVersion is ignored for prefix watches.
+		FromVersion uuid.UUID
+
+		// Buffer is the number of events buffered for a slow consumer, DefaultWatchBuffer if zero.
+		Buffer int
+	}
+
+	// Event is a change of a key.
+	Event struct {
+		Type       EventType
+		Key, Value string
+
+		// OldVersion is zero if the key was created, NewVersion is zero if it was deleted.
+		OldVersion, NewVersion uuid.UUID
+
+		// Revision orders the events of a store.
+		Revision int64
+	}
+
+	EventType int
+)
+
+const (
+	EventPut EventType = iota
+	EventDelete
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventPut:
+		return "put"
+	case EventDelete:
+		return "delete"
+	default:
+		return fmt.Sprintf("EventType(%d)", int(t))
+	}
+}
+
+func (r *WatchRequest) matches(key string) bool {
+	if r.Prefix {
+		return strings.HasPrefix(key, r.Key)
+	}
+	return key == r.Key
+}
+
+// Watch is a stream of events.
+type Watch struct {
+	events chan Event
+	err    error
+	stop   func(err error)
+}
+
+// Events returns the channel of events. It is closed when the watch ends,
+// after that Err tells the reason.
+func (w *Watch) Events() <-chan Event {
+	return w.events
+}
+
+// Err returns the reason the watch ended: ErrWatchOverflow, ErrWatchClosed or
+// the error of the context. It must be called only after Events is closed.
+func (w *Watch) Err() error {
+	return w.err
+}
+
+// Close stops the watch and releases its resources.
+func (w *Watch) Close() {
+	w.stop(ErrWatchClosed)
+}
@@ -0,0 +1,232 @@
+package kvapi_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+
+	"gitlab.com/slon/shad-go/retryupdate"
+	"gitlab.com/slon/shad-go/retryupdate/kvapi"
+)
+
+func nextEvent(t *testing.T, w *kvapi.Watch) kvapi.Event {
+	t.Helper()
+
+	select {
+	case ev, ok := <-w.Events():
+		require.True(t, ok, "watch ended: %v", w.Err())
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+		return kvapi.Event{}
+	}
+}
+
+func requireNoEvent(t *testing.T, w *kvapi.Watch) {
+	t.Helper()
+
+	select {
+	case ev := <-w.Events():
+		t.Fatalf("unexpected event %+v", ev)
+	default:
+	}
+}
+
+func TestWatch(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := kvapi.NewMemoryClient()
+
+	key, err := c.Watch(context.Background(), &kvapi.WatchRequest{Key: "cfg/a"})
+	require.NoError(t, err)
+	defer key.Close()
+
+	prefix, err := c.Watch(context.Background(), &kvapi.WatchRequest{Key: "cfg/", Prefix: true})
+	require.NoError(t, err)
+	defer prefix.Close()
+
+	v1, v2, v3 := newVersion(), newVersion(), newVersion()
+
+	_, err = c.Set(&kvapi.SetRequest{Key: "cfg/a", Value: "1", NewVersion: v1})
+	require.NoError(t, err)
+	_, err = c.Set(&kvapi.SetRequest{Key: "other", Value: "1", NewVersion: newVersion()})
+	require.NoError(t, err)
+	_, err = c.Txn(&kvapi.TxnRequest{Ops: []kvapi.Op{kvapi.Put("cfg/a", "2", v2), kvapi.Put("cfg/b", "3", v3)}})
+	require.NoError(t, err)
+	_, err = c.Delete(&kvapi.DeleteRequest{Key: "cfg/a", OldVersion: v2})
+	require.NoError(t, err)
+
+	want := []kvapi.Event{
+		{Type: kvapi.EventPut, Key: "cfg/a", Value: "1", NewVersion: v1, Revision: 1},
+		{Type: kvapi.EventPut, Key: "cfg/a", Value: "2", OldVersion: v1, NewVersion: v2, Revision: 3},
+		{Type: kvapi.EventDelete, Key: "cfg/a", OldVersion: v2, Revision: 5},
+	}
+	for _, ev := range want {
+		require.Equal(t, ev, nextEvent(t, key))
+	}
+	requireNoEvent(t, key)
+
+	var keys []string
+	for i := 0; i < 4; i++ {
+		keys = append(keys, nextEvent(t, prefix).Key)
+	}
+	require.Equal(t, []string{"cfg/a", "cfg/a", "cfg/b", "cfg/a"}, keys)
+	requireNoEvent(t, prefix)
+
+	key.Close()
+	_, ok := <-key.Events()
+	require.False(t, ok)
+	require.ErrorIs(t, key.Err(), kvapi.ErrWatchClosed)
+}
+
+func TestWatch_fromVersion(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := kvapi.NewMemoryClient()
+
+	v1, v2 := newVersion(), newVersion()
+	_, err := c.Set(&kvapi.SetRequest{Key: "k", Value: "1", NewVersion: v1})
+	require.NoError(t, err)
+
+	w, err := c.Watch(context.Background(), &kvapi.WatchRequest{Key: "k", FromVersion: v1})
+	require.NoError(t, err)
+	requireNoEvent(t, w)
+	w.Close()
+
+	_, err = c.Set(&kvapi.SetRequest{Key: "k", Value: "2", OldVersion: v1, NewVersion: v2})
+	require.NoError(t, err)
+
+	w, err = c.Watch(context.Background(), &kvapi.WatchRequest{Key: "k", FromVersion: v1})
+	require.NoError(t, err)
+	defer w.Close()
+
+	ev := nextEvent(t, w)
+	require.Equal(t, kvapi.EventPut, ev.Type)
+	require.Equal(t, "2", ev.Value)
+	require.Equal(t, v1, ev.OldVersion)
+	require.Equal(t, v2, ev.NewVersion)
+
+	missing, err := c.Watch(context.Background(), &kvapi.WatchRequest{Key: "missing", FromVersion: v1})
+	require.NoError(t, err)
+	defer missing.Close()
+
+	ev = nextEvent(t, missing)
+	require.Equal(t, kvapi.EventDelete, ev.Type)
+	require.Equal(t, uuid.Nil, ev.NewVersion)
+}
+
+func TestWatch_overflow(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := kvapi.NewMemoryClient()
+
+	w, err := c.Watch(context.Background(), &kvapi.WatchRequest{Key: "k", Buffer: 2})
+	require.NoError(t, err)
+
+	version := uuid.Nil
+	for i := 0; i < 3; i++ {
+		next := newVersion()
+		_, err := c.Set(&kvapi.SetRequest{Key: "k", Value: "v", OldVersion: version, NewVersion: next})
+		require.NoError(t, err, "writers must not block on slow watches")
+		version = next
+	}
+
+	var events int
+	for range w.Events() {
+		events++
+	}
+	require.Equal(t, 2, events)
+	require.ErrorIs(t, w.Err(), kvapi.ErrWatchOverflow)
+
+	w.Close()
+}
+
+func TestWatch_cancel(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	c := kvapi.NewMemoryClient()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := c.Watch(ctx, &kvapi.WatchRequest{Key: "k", Prefix: true})
+	require.NoError(t, err)
+
+	cancel()
+	for range w.Events() {
+	}
+	require.ErrorIs(t, w.Err(), context.Canceled)
+
+	_, err = c.Watch(ctx, &kvapi.WatchRequest{Key: "k"})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+// watchedCache caches values of a store and drops them on change events.
+type watchedCache struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (c *watchedCache) run(w *kvapi.Watch) {
+	for ev := range w.Events() {
+		c.mu.Lock()
+		delete(c.values, ev.Key)
+		c.mu.Unlock()
+	}
+}
+
+func (c *watchedCache) get(store kvapi.Client, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if v, ok := c.values[key]; ok {
+		return v, nil
+	}
+
+	rsp, err := store.Get(&kvapi.GetRequest{Key: key})
+	if err != nil {
+		return "", err
+	}
+	c.values[key] = rsp.Value
+	return rsp.Value, nil
+}
+
+func TestWatch_cacheInvalidation(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	store := kvapi.NewMemoryClient()
+
+	w, err := store.Watch(context.Background(), &kvapi.WatchRequest{Key: "", Prefix: true})
+	require.NoError(t, err)
+
+	cache := &watchedCache{values: make(map[string]string)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cache.run(w)
+	}()
+
+	increment := func(oldValue *string) (string, error) {
+		if oldValue == nil {
+			return "1", nil
+		}
+		n, err := strconv.Atoi(*oldValue)
+		return strconv.Itoa(n + 1), err
+	}
+
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, retryupdate.UpdateValue(store, "counter", increment))
+
+		require.Eventually(t, func() bool {
+			v, err := cache.get(store, "counter")
+			return err == nil && v == strconv.Itoa(i)
+		}, time.Second, time.Millisecond)
+	}
+
+	w.Close()
+	<-done
+}
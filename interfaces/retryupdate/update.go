@@ -3,77 +3,271 @@
 package retryupdate
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"time"
+
 	"github.com/gofrs/uuid"
+
 	"gitlab.com/slon/shad-go/retryupdate/kvapi"
 )
 
+var (
+	// ErrRetriesExhausted is reported by RetryError when the backoff policy gives up.
+	ErrRetriesExhausted = errors.New("retryupdate: retries exhausted")
+	// ErrMaybeApplied is matched by errors returned after a write that might have been applied.
+	ErrMaybeApplied = errors.New("retryupdate: write may have been applied")
+)
+
+// Options configure UpdateValueWithOptions.
+type Options struct {
+	// Backoff is the retry policy, NoBackoff if nil.
+	Backoff Backoff
+
+	// FailOnAmbiguousWrite makes UpdateValueWithOptions return a *MaybeAppliedError
+	// instead of applying updateFn again when it can not tell whether
+	// a failed Set was applied.
+	FailOnAmbiguousWrite bool
+}
+
+// MaybeAppliedError is returned when the update stops after a Set
+// that failed, but might have been applied.
+type MaybeAppliedError struct {
+	Key string
+	// Version is the version the Set would have stored.
+	Version uuid.UUID
+	// Err is the error that stopped the update.
+	Err error
+}
+
+func (e *MaybeAppliedError) Error() string {
+	return fmt.Sprintf("retryupdate: write of %q may have been applied: %v", e.Key, e.Err)
+}
+
+func (e *MaybeAppliedError) Unwrap() error {
+	return e.Err
+}
+
+func (e *MaybeAppliedError) Is(target error) bool {
+	return target == ErrMaybeApplied
+}
+
+// RetryError is returned by UpdateValueContext when it stops retrying
+// because of the backoff policy or the context.
+type RetryError struct {
+	// Attempts is the number of API calls made.
+	Attempts int
+	// LastErr is the last error returned by the API, nil if there was none.
+	LastErr error
+	// Reason is ErrRetriesExhausted or the error of the context.
+	Reason error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%v after %d attempts, last error: %v", e.Reason, e.Attempts, e.LastErr)
+}
+
+func (e *RetryError) Unwrap() []error {
+	if e.LastErr == nil {
+		return []error{e.Reason}
+	}
+	return []error{e.Reason, e.LastErr}
+}
+
+// retrier counts attempts and waits between them.
+type retrier struct {
+	ctx     context.Context
+	backoff Backoff
+	start   time.Time
+
+	attempts int
+	failures int
+	lastErr  error
+}
+
+// attempt is called before every API call.
+func (r *retrier) attempt() error {
+	if err := r.ctx.Err(); err != nil {
+		return &RetryError{Attempts: r.attempts, LastErr: r.lastErr, Reason: err}
+	}
+	r.attempts++
+	return nil
+}
+
+// retry is called after a failed API call and waits for the delay chosen by the backoff policy.
+func (r *retrier) retry(err error) error {
+	r.lastErr = err
+	r.failures++
+
+	delay, ok := r.backoff.Next(r.failures, time.Since(r.start))
+	if !ok {
+		return &RetryError{Attempts: r.attempts, LastErr: err, Reason: ErrRetriesExhausted}
+	}
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-r.ctx.Done():
+		return &RetryError{Attempts: r.attempts, LastErr: err, Reason: r.ctx.Err()}
+	}
+}
+
+func isAuthError(err error) bool {
+	var errAuth *kvapi.AuthError
+	return errors.As(err, &errAuth)
+}
+
+// UpdateValue is UpdateValueContext that retries immediately and forever.
 func UpdateValue(c kvapi.Client, key string, updateFn func(oldValue *string) (newValue string, err error)) error {
-	var prevOldVersion = uuid.Nil
+	return UpdateValueContext(context.Background(), c, key, updateFn, NoBackoff)
+}
+
+// UpdateValueContext is UpdateValueWithOptions with the given backoff policy.
+func UpdateValueContext(
+	ctx context.Context,
+	c kvapi.Client,
+	key string,
+	updateFn func(oldValue *string) (newValue string, err error),
+	backoff Backoff,
+) error {
+	return UpdateValueWithOptions(ctx, c, key, updateFn, Options{Backoff: backoff})
+}
+
+// UpdateValueWithOptions reads the value of key, computes the new value with updateFn
+// and writes it back, re-reading the value on conflicts.
+//
+// Authentication errors and errors of updateFn are returned immediately. Other API errors
+// and conflicts are retried as long as the backoff policy and ctx allow; once they don't,
+// UpdateValueWithOptions returns a *RetryError.
+//
+// A Set failing with an error other than a conflict, ErrKeyNotFound or an auth error
+// might have been applied. Whether it was is decided as follows:
+//
+//   - If c is a kvapi.IdempotentClient, retries of the Set carry the same request id,
+//     and the store reports a retry of an applied Set as successful. If SetIdempotent
+//     fails with kvapi.ErrNotSupported, plain Set is used from then on.
+//   - Otherwise retries of the Set carry the same new version. A conflict expecting
+//     this version means the Set was applied.
+//   - If the value was changed or deleted by another writer before the retry, it is
+//     unknown whether the Set was applied. By default, the value is read again and
+//     updateFn is applied to it, so the update may be applied twice. With
+//     Options.FailOnAmbiguousWrite, a *MaybeAppliedError is returned instead.
+//
+// An error returned after a Set that might have been applied matches ErrMaybeApplied.
+func UpdateValueWithOptions(
+	ctx context.Context,
+	c kvapi.Client,
+	key string,
+	updateFn func(oldValue *string) (newValue string, err error),
+	opts Options,
+) error {
+	backoff := opts.Backoff
+	if backoff == nil {
+		backoff = NoBackoff
+	}
+	r := &retrier{ctx: ctx, backoff: backoff, start: time.Now()}
+
+	ic, idempotent := c.(kvapi.IdempotentClient)
+
 	for {
-		getResp, err := c.Get(&kvapi.GetRequest{Key: key})
-		var newValue string
-		var errApi *kvapi.APIError
+		if err := r.attempt(); err != nil {
+			return err
+		}
 
-		if errors.Is(err, kvapi.ErrKeyNotFound) {
-			newValue, err = updateFn(nil)
-			if err != nil {
-				return err
-			}
-		} else if errors.As(err, &errApi) {
-			var errTemp *kvapi.AuthError
-			if errors.As(errApi, &errTemp) {
+		var oldValue *string
+		var oldVersion uuid.UUID
+
+		getResp, err := c.Get(&kvapi.GetRequest{Key: key})
+		switch {
+		case err == nil:
+			oldValue, oldVersion = &getResp.Value, getResp.Version
+		case errors.Is(err, kvapi.ErrKeyNotFound):
+		case isAuthError(err):
+			return err
+		default:
+			if err := r.retry(err); err != nil {
 				return err
 			}
 			continue
-		} else if err != nil {
-			continue
-		} else {
-			newValue, err = updateFn(&getResp.Value)
-			if err != nil {
-				return err
-			}
 		}
 
+		newValue, err := updateFn(oldValue)
+		if err != nil {
+			return err
+		}
+
+		// Retries of Set reuse the version and the request id: a failed Set
+		// might have been applied anyway.
+		newVersion, requestID := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+		// maybeApplied is set once a Set of newVersion failed ambiguously.
+		maybeApplied := false
+
+		ambiguous := func(err error) error {
+			return &MaybeAppliedError{Key: key, Version: newVersion, Err: err}
+		}
+
+	set:
 		for {
-			var oldVersion uuid.UUID
-			if getResp == nil {
-				oldVersion = uuid.UUID{}
-			} else {
-				oldVersion = getResp.Version
+			if err := r.attempt(); err != nil {
+				if maybeApplied {
+					return ambiguous(err)
+				}
+				return err
 			}
 
-			newVersion := uuid.Must(uuid.NewV4())
-			_, err = c.Set(&kvapi.SetRequest{
-				Key:        key,
-				Value:      newValue,
-				OldVersion: oldVersion,
-				NewVersion: newVersion},
-			)
+			req := kvapi.SetRequest{Key: key, Value: newValue, OldVersion: oldVersion, NewVersion: newVersion}
+			if idempotent {
+				_, err = ic.SetIdempotent(&kvapi.IdempotentSetRequest{SetRequest: req, RequestID: requestID})
+			} else {
+				_, err = c.Set(&req)
+			}
 
 			var errConflict *kvapi.ConflictError
-			var errApi *kvapi.APIError
-			var errAuth *kvapi.AuthError
-
-			if errors.As(err, &errApi) {
-				if errors.Is(errApi, kvapi.ErrKeyNotFound) {
-					newValue, err = updateFn(nil)
-					if err != nil {
-						return err
-					}
-					getResp = nil
-				} else if errors.As(errApi, &errAuth) {
+			switch {
+			case err == nil:
+				return nil
+			case idempotent && errors.Is(err, kvapi.ErrNotSupported):
+				// The store rejected the call without applying it.
+				idempotent = false
+			case isAuthError(err):
+				if maybeApplied {
+					return ambiguous(err)
+				}
+				return err
+			case errors.Is(err, kvapi.ErrKeyNotFound):
+				if maybeApplied && opts.FailOnAmbiguousWrite {
+					return ambiguous(err)
+				}
+				newValue, err = updateFn(nil)
+				if err != nil {
 					return err
-				} else if errors.As(errApi, &errConflict) {
-					if errConflict.ExpectedVersion == prevOldVersion {
-						return nil
-					}
-					break
 				}
-			} else if err == nil {
-				return nil
+				oldVersion, newVersion, requestID = uuid.Nil, uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+				maybeApplied = false
+			case errors.As(err, &errConflict):
+				if errConflict.ExpectedVersion == newVersion {
+					return nil
+				}
+				if maybeApplied && opts.FailOnAmbiguousWrite {
+					return ambiguous(err)
+				}
+				if err := r.retry(err); err != nil {
+					return err
+				}
+				break set
+			default:
+				maybeApplied = true
+				if err := r.retry(err); err != nil {
+					return ambiguous(err)
+				}
 			}
-			prevOldVersion = newVersion
 		}
 	}
 }
@@ -0,0 +1,142 @@
+//go:build !solution
+
+package retryupdate
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"gitlab.com/slon/shad-go/retryupdate/kvapi"
+)
+
+var errUnreadKeys = errors.New("retryupdate: updateFn changed keys that were not read")
+
+// UpdateValues is the multi-key UpdateValueContext.
+//
+// It reads keys and passes their values to updateFn, nil for missing keys. updateFn returns
+// the keys to change: a nil value deletes the key, keys absent from the result keep their values.
+// The changes are committed by a transaction conditioned on the versions of all read keys,
+// so that concurrent updates of any of them make UpdateValues read the keys again.
+// A nil backoff means NoBackoff.
+func UpdateValues(
+	ctx context.Context,
+	c kvapi.TxnClient,
+	keys []string,
+	updateFn func(oldValues map[string]*string) (newValues map[string]*string, err error),
+	backoff Backoff,
+) error {
+	if backoff == nil {
+		backoff = NoBackoff
+	}
+	r := &retrier{ctx: ctx, backoff: backoff, start: time.Now()}
+
+read:
+	for {
+		oldValues := make(map[string]*string, len(keys))
+		compare := make([]kvapi.Compare, 0, len(keys))
+
+		for _, key := range keys {
+			if err := r.attempt(); err != nil {
+				return err
+			}
+
+			getResp, err := c.Get(&kvapi.GetRequest{Key: key})
+			switch {
+			case err == nil:
+				oldValues[key] = &getResp.Value
+				compare = append(compare, kvapi.Compare{Key: key, Version: getResp.Version})
+			case errors.Is(err, kvapi.ErrKeyNotFound):
+				oldValues[key] = nil
+				compare = append(compare, kvapi.Compare{Key: key})
+			case isAuthError(err):
+				return err
+			default:
+				if err := r.retry(err); err != nil {
+					return err
+				}
+				continue read
+			}
+		}
+
+		newValues, err := updateFn(oldValues)
+		if err != nil {
+			return err
+		}
+
+		// As in UpdateValueContext, retries of the transaction reuse the versions,
+		// which tells whether a failed transaction was applied anyway.
+		// maybeApplied is set once the transaction failed ambiguously.
+		var ops []kvapi.Op
+		for _, key := range keys {
+			newValue, ok := newValues[key]
+			switch {
+			case !ok:
+			case newValue == nil:
+				ops = append(ops, kvapi.Delete(key))
+			default:
+				ops = append(ops, kvapi.Put(key, *newValue, uuid.Must(uuid.NewV4())))
+			}
+		}
+		if len(ops) != len(newValues) {
+			return errUnreadKeys
+		}
+		if len(ops) == 0 {
+			return nil
+		}
+
+		maybeApplied := false
+		for {
+			if err := r.attempt(); err != nil {
+				return err
+			}
+
+			_, err := c.Txn(&kvapi.TxnRequest{Compare: compare, Ops: ops})
+
+			var errConflict *kvapi.TxnConflictError
+			switch {
+			case err == nil:
+				return nil
+			case isAuthError(err):
+				return err
+			case errors.As(err, &errConflict):
+				if maybeApplied && txnApplied(errConflict, ops) {
+					return nil
+				}
+				if err := r.retry(err); err != nil {
+					return err
+				}
+				continue read
+			default:
+				maybeApplied = true
+				if err := r.retry(err); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// txnApplied reports whether a conflict shows a version written by ops,
+// that is the transaction was applied by an earlier attempt.
+//
+// The versions of puts are fresh, so a key stored under one of them proves that the
+// transaction committed. Deletes leave no version behind: a transaction of deletes
+// only is never recognized as applied.
+func txnApplied(errConflict *kvapi.TxnConflictError, ops []kvapi.Op) bool {
+	written := make(map[string]uuid.UUID, len(ops))
+	for _, op := range ops {
+		if op.Type == kvapi.OpPut && op.NewVersion != uuid.Nil {
+			written[op.Key] = op.NewVersion
+		}
+	}
+
+	for _, conflict := range errConflict.Conflicts {
+		if version, ok := written[conflict.Key]; ok && conflict.ExpectedVersion == version {
+			return true
+		}
+	}
+	return false
+}
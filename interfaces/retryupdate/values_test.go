@@ -0,0 +1,155 @@
+package retryupdate_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/retryupdate"
+	"gitlab.com/slon/shad-go/retryupdate/kvapi"
+)
+
+func balance(value *string) int {
+	if value == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(*value)
+	return n
+}
+
+// transfer moves one unit from one account to another, deleting empty accounts.
+func transfer(from, to string) func(map[string]*string) (map[string]*string, error) {
+	return func(old map[string]*string) (map[string]*string, error) {
+		fromBalance, toBalance := balance(old[from])-1, balance(old[to])+1
+
+		newValues := make(map[string]*string)
+		if fromBalance == 0 {
+			newValues[from] = nil
+		} else {
+			s := strconv.Itoa(fromBalance)
+			newValues[from] = &s
+		}
+		s := strconv.Itoa(toBalance)
+		newValues[to] = &s
+		return newValues, nil
+	}
+}
+
+func TestUpdateValues(t *testing.T) {
+	const transfers = 30
+
+	for _, tc := range []struct {
+		name    string
+		workers int
+		opts    kvapi.FaultOptions
+	}{
+		{name: "noFaults", workers: 4},
+		{name: "errors", workers: 4, opts: kvapi.FaultOptions{ErrorRate: 0.3, Seed: 1}},
+		{name: "conflicts", workers: 4, opts: kvapi.FaultOptions{ErrorRate: 0.1, ConflictRate: 0.3, Seed: 2}},
+		{name: "lostResponses", workers: 1, opts: kvapi.FaultOptions{ErrorRate: 0.2, LostResponseRate: 0.3, Seed: 3}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := kvapi.NewMemoryClient()
+			c := kvapi.NewFaultyClient(store, tc.opts)
+			accounts := []string{"alice", "bob", "carol"}
+
+			var wg sync.WaitGroup
+			for i := 0; i < tc.workers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					backoff := &retryupdate.ExponentialBackoff{Initial: time.Microsecond, Max: time.Millisecond, Jitter: 1}
+					for j := 0; j < transfers; j++ {
+						from, to := accounts[(i+j)%3], accounts[(i+j+1)%3]
+						err := retryupdate.UpdateValues(context.Background(), c, []string{from, to}, transfer(from, to), backoff)
+						if err != nil {
+							t.Errorf("UpdateValues: %v", err)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			rsp, err := store.List(&kvapi.ListRequest{})
+			require.NoError(t, err)
+
+			total := 0
+			for _, e := range rsp.Entries {
+				total += balance(&e.Value)
+			}
+			require.Zero(t, total, "transfers must preserve the total balance")
+		})
+	}
+}
+
+func TestUpdateValues_unreadKey(t *testing.T) {
+	c := kvapi.NewMemoryClient()
+
+	err := retryupdate.UpdateValues(context.Background(), c, []string{"a"}, transfer("a", "b"), retryupdate.NoBackoff)
+	require.Error(t, err)
+
+	rsp, err := c.List(&kvapi.ListRequest{})
+	require.NoError(t, err)
+	require.Empty(t, rsp.Entries)
+}
+
+func TestUpdateValues_noChanges(t *testing.T) {
+	c := kvapi.NewFaultyClient(kvapi.NewMemoryClient(), kvapi.FaultOptions{ConflictRate: 1})
+
+	err := retryupdate.UpdateValues(context.Background(), c, []string{"a", "b"}, func(map[string]*string) (map[string]*string, error) {
+		return nil, nil
+	}, retryupdate.NoBackoff)
+	require.NoError(t, err)
+}
+
+// racingTxnClient deletes a key right before the first Txn.
+type racingTxnClient struct {
+	*kvapi.MemoryClient
+	deleteKey string
+	raced     bool
+}
+
+func (c *racingTxnClient) Txn(req *kvapi.TxnRequest) (*kvapi.TxnResponse, error) {
+	if !c.raced {
+		c.raced = true
+		rsp, err := c.Get(&kvapi.GetRequest{Key: c.deleteKey})
+		if err == nil {
+			_, _ = c.Delete(&kvapi.DeleteRequest{Key: c.deleteKey, OldVersion: rsp.Version})
+		}
+	}
+	return c.MemoryClient.Txn(req)
+}
+
+func TestUpdateValues_concurrentDelete(t *testing.T) {
+	store := kvapi.NewMemoryClient()
+	for _, key := range []string{"a", "b"} {
+		_, err := store.Set(&kvapi.SetRequest{Key: key, Value: "1", NewVersion: uuid.Must(uuid.NewV4())})
+		require.NoError(t, err)
+	}
+	c := &racingTxnClient{MemoryClient: store, deleteKey: "b"}
+
+	// Increment a and delete b: a concurrent delete of b must not pass for this transaction.
+	err := retryupdate.UpdateValues(context.Background(), c, []string{"a", "b"}, func(old map[string]*string) (map[string]*string, error) {
+		a := strconv.Itoa(balance(old["a"]) + 1)
+		return map[string]*string{"a": &a, "b": nil}, nil
+	}, retryupdate.NoBackoff)
+	require.NoError(t, err)
+
+	rsp, err := store.Get(&kvapi.GetRequest{Key: "a"})
+	require.NoError(t, err)
+	require.Equal(t, "2", rsp.Value)
+}
+
+func TestUpdateValues_nilBackoff(t *testing.T) {
+	c := kvapi.NewFaultyClient(kvapi.NewMemoryClient(), kvapi.FaultOptions{ErrorRate: 0.3, Seed: 1})
+
+	err := retryupdate.UpdateValues(context.Background(), c, []string{"a", "b"}, transfer("a", "b"), nil)
+	require.NoError(t, err)
+}